@@ -0,0 +1,134 @@
+// Package annot reads genome annotations in the BED, GFF3 and GTF formats.
+package annot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format is an annotation file format.
+type Format int
+
+const (
+	BED Format = iota
+	GFF3
+	GTF
+)
+
+func (f Format) String() string {
+	switch f {
+	case BED:
+		return "BED"
+	case GFF3:
+		return "GFF3"
+	case GTF:
+		return "GTF"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Attr is a key/value attribute of a feature.
+type Attr struct {
+	Key   string
+	Value string
+}
+
+// Block is a part of a feature, such as an exon of a BED12 transcript, with
+// 0-based, half-open coordinates.
+type Block struct {
+	Start int64
+	End   int64
+}
+
+// Feature is an annotated interval. Coordinates are 0-based and half-open
+// whatever the file format.
+type Feature struct {
+	Seq    string
+	Start  int64
+	End    int64
+	Strand byte   // '+', '-' or '.'
+	Source string // GFF/GTF source
+	Type   string // GFF/GTF feature type; empty for BED
+	Phase  int    // GFF/GTF phase of CDS features, or -1
+	Name   string // BED name
+	Attrs  []Attr // GFF/GTF attributes, in file order
+	Blocks []Block
+}
+
+// Attr returns the value of the first attribute with the given key. For BED
+// features, "name" is the name column.
+func (f *Feature) Attr(key string) (string, bool) {
+	for _, a := range f.Attrs {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	if key == "name" && f.Name != "" {
+		return f.Name, true
+	}
+	return "", false
+}
+
+// HasAttr reports whether the feature has an attribute key with the given
+// value, among comma-separated values in GFF3 (e.g. Parent=tx1,tx2).
+func (f *Feature) HasAttr(key, value string) bool {
+	for _, a := range f.Attrs {
+		if a.Key != key {
+			continue
+		}
+		for _, v := range strings.Split(a.Value, ",") {
+			if v == value {
+				return true
+			}
+		}
+	}
+	return key == "name" && f.Name == value
+}
+
+// Read reads all features of an annotation file.
+func Read(r io.Reader, format Format) ([]*Feature, error) {
+	var parse func(fields []string) (*Feature, error)
+	switch format {
+	case BED:
+		parse = parseBED
+	case GFF3:
+		parse = parseGFF3
+	case GTF:
+		parse = parseGTF
+	default:
+		return nil, fmt.Errorf("annot: unknown format %v", format)
+	}
+
+	var features []*Feature
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1<<16), 1<<26)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if format == GFF3 && text == "##FASTA" {
+			// Sequences follow the annotations.
+			break
+		}
+		if text == "" || strings.HasPrefix(text, "#") ||
+			(format == BED && (strings.HasPrefix(text, "track") || strings.HasPrefix(text, "browser"))) {
+			continue
+		}
+		f, err := parse(strings.Split(text, "\t"))
+		if err != nil {
+			return nil, fmt.Errorf("annot: %v line %d: %v", format, line, err)
+		}
+		features = append(features, f)
+	}
+	return features, scanner.Err()
+}
+
+func parseStrand(s string) (byte, error) {
+	switch s {
+	case "+", "-", ".":
+		return s[0], nil
+	case "?":
+		return '.', nil
+	}
+	return 0, fmt.Errorf("bad strand %q", s)
+}
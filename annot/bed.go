@@ -0,0 +1,68 @@
+package annot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseBED parses a BED3 to BED12 line. The blocks of BED12 lines become the
+// feature's Blocks.
+func parseBED(fields []string) (*Feature, error) {
+	if len(fields) == 1 {
+		// Allow space-separated BED.
+		fields = strings.Fields(fields[0])
+	}
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("expected at least 3 columns, found %d", len(fields))
+	}
+	f := &Feature{Seq: fields[0], Strand: '.', Phase: -1}
+	var err error
+	if f.Start, err = strconv.ParseInt(fields[1], 10, 64); err != nil || f.Start < 0 {
+		return nil, fmt.Errorf("bad start %q", fields[1])
+	}
+	if f.End, err = strconv.ParseInt(fields[2], 10, 64); err != nil || f.End < f.Start {
+		return nil, fmt.Errorf("bad end %q", fields[2])
+	}
+	if len(fields) > 3 {
+		f.Name = fields[3]
+	}
+	if len(fields) > 5 {
+		if f.Strand, err = parseStrand(fields[5]); err != nil {
+			return nil, err
+		}
+	}
+	if len(fields) >= 12 {
+		count, err := strconv.Atoi(fields[9])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("bad block count %q", fields[9])
+		}
+		sizes := splitInts(fields[10])
+		starts := splitInts(fields[11])
+		if sizes == nil || starts == nil || len(sizes) < count || len(starts) < count {
+			return nil, fmt.Errorf("expected %d block sizes and starts", count)
+		}
+		for i := 0; i < count; i++ {
+			b := Block{f.Start + starts[i], f.Start + starts[i] + sizes[i]}
+			if b.Start < f.Start || b.End > f.End || b.End < b.Start {
+				return nil, fmt.Errorf("block %d lies outside the feature", i+1)
+			}
+			f.Blocks = append(f.Blocks, b)
+		}
+	}
+	return f, nil
+}
+
+// splitInts parses a comma-separated list of integers, which may end with a
+// comma; it returns nil if any is malformed.
+func splitInts(s string) []int64 {
+	var ints []int64
+	for _, field := range strings.Split(strings.TrimSuffix(s, ","), ",") {
+		v, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil
+		}
+		ints = append(ints, v)
+	}
+	return ints
+}
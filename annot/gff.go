@@ -0,0 +1,166 @@
+package annot
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parseGFFColumns parses the 8 columns shared by GFF3 and GTF, which have
+// 1-based, inclusive coordinates.
+func parseGFFColumns(fields []string) (*Feature, error) {
+	if len(fields) != 9 {
+		return nil, fmt.Errorf("expected 9 tab-separated columns, found %d", len(fields))
+	}
+	f := &Feature{Seq: fields[0], Source: fields[1], Type: fields[2], Phase: -1}
+	start, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil || start < 1 {
+		return nil, fmt.Errorf("bad start %q", fields[3])
+	}
+	if f.End, err = strconv.ParseInt(fields[4], 10, 64); err != nil || f.End < start {
+		return nil, fmt.Errorf("bad end %q", fields[4])
+	}
+	f.Start = start - 1
+	if f.Strand, err = parseStrand(fields[6]); err != nil {
+		return nil, err
+	}
+	switch fields[7] {
+	case ".":
+	case "0", "1", "2":
+		f.Phase = int(fields[7][0] - '0')
+	default:
+		return nil, fmt.Errorf("bad phase %q", fields[7])
+	}
+	return f, nil
+}
+
+// parseGFF3 parses a GFF3 line, whose attributes are key=value pairs
+// separated by ';' with URL escapes.
+func parseGFF3(fields []string) (*Feature, error) {
+	f, err := parseGFFColumns(fields)
+	if err != nil {
+		return nil, err
+	}
+	if fields[8] == "." {
+		return f, nil
+	}
+	for _, pair := range strings.Split(fields[8], ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad attribute %q", pair)
+		}
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		f.Attrs = append(f.Attrs, Attr{key, value})
+	}
+	return f, nil
+}
+
+// parseGTF parses a GTF line, whose attributes are key "value" pairs each
+// followed by ';'.
+func parseGTF(fields []string) (*Feature, error) {
+	f, err := parseGFFColumns(fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range strings.Split(fields[8], ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, " ")
+		if !ok {
+			return nil, fmt.Errorf("bad attribute %q", pair)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `"`)
+		}
+		f.Attrs = append(f.Attrs, Attr{key, value})
+	}
+	return f, nil
+}
+
+// gff3Escaper escapes the characters with special meanings in GFF3 columns
+// and attribute values.
+var gff3Escaper = strings.NewReplacer("%", "%25", ";", "%3B", "=", "%3D", "&", "%26", ",", "%2C",
+	"\t", "%09", "\n", "%0A", "\r", "%0D")
+
+// WriteGFF3 writes a feature as GFF3. Features with blocks are written as one
+// line per block sharing the attributes (so they should have an ID), with the
+// phases of CDS blocks following from the feature's phase in the order of
+// transcription. Repeated attribute keys are written as one attribute with
+// comma-separated values.
+func WriteGFF3(w io.Writer, f *Feature) error {
+	var attrs strings.Builder
+	for i, a := range f.Attrs {
+		seen := false
+		for _, b := range f.Attrs[:i] {
+			seen = seen || b.Key == a.Key
+		}
+		if seen {
+			continue
+		}
+		if attrs.Len() > 0 {
+			attrs.WriteByte(';')
+		}
+		attrs.WriteString(gff3Escaper.Replace(a.Key))
+		attrs.WriteByte('=')
+		for j, b := range f.Attrs[i:] {
+			if b.Key != a.Key {
+				continue
+			}
+			if j > 0 {
+				attrs.WriteByte(',')
+			}
+			attrs.WriteString(gff3Escaper.Replace(b.Value))
+		}
+	}
+	if attrs.Len() == 0 {
+		attrs.WriteByte('.')
+	}
+	source := f.Source
+	if source == "" {
+		source = "."
+	}
+
+	blocks := f.Blocks
+	if len(blocks) == 0 {
+		blocks = []Block{{f.Start, f.End}}
+	}
+	phases := make([]string, len(blocks))
+	for i := range phases {
+		phases[i] = "."
+	}
+	if f.Phase >= 0 {
+		order := make([]int, len(blocks))
+		for i := range order {
+			order[i] = i
+			if f.Strand == '-' {
+				order[i] = len(blocks) - 1 - i
+			}
+		}
+		phase := int64(f.Phase)
+		for _, i := range order {
+			phases[i] = strconv.FormatInt(phase, 10)
+			phase = (3 - (blocks[i].End-blocks[i].Start-phase)%3) % 3
+		}
+	}
+	for i, b := range blocks {
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t.\t%c\t%s\t%s\n", gff3Escaper.Replace(f.Seq), source,
+			f.Type, b.Start+1, b.End, f.Strand, phases[i], attrs.String())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Package bgzf reads and writes the Blocked GNU Zip Format used by bgzip, samtools and
+// BAM files: a series of gzip members ("blocks") of at most 64 KiB of
+// uncompressed data, each recording its own compressed size so that a file
+// can be decompressed from any block boundary.
+package bgzf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// MaxBlockSize is the largest size of a block, compressed or not.
+const MaxBlockSize = 1 << 16
+
+// fixedHeaderLen is the length of a gzip header up to its extra field.
+const fixedHeaderLen = 12
+
+var (
+	ErrNotBGZF  = errors.New("bgzf: not in BGZF format")
+	ErrCorrupt  = errors.New("bgzf: corrupt block")
+	ErrChecksum = errors.New("bgzf: block checksum mismatch")
+	gzipMagic   = []byte{0x1f, 0x8b}
+)
+
+// IsGzip reports whether header, the first bytes of a file, starts a gzip
+// member.
+func IsGzip(header []byte) bool {
+	return bytes.HasPrefix(header, gzipMagic)
+}
+
+// IsBGZF reports whether header, the first bytes of a file (at least 18),
+// starts a BGZF block.
+func IsBGZF(header []byte) bool {
+	_, _, err := parseHeader(header)
+	return err == nil
+}
+
+// parseHeader returns the total size of the block starting with header, and
+// the length of its gzip header.
+func parseHeader(header []byte) (blockSize, headerLen int, err error) {
+	if len(header) < fixedHeaderLen || !IsGzip(header) || header[2] != 8 || header[3]&4 == 0 {
+		return 0, 0, ErrNotBGZF
+	}
+	xlen := int(binary.LittleEndian.Uint16(header[10:12]))
+	if len(header) < fixedHeaderLen+xlen {
+		return 0, 0, ErrNotBGZF
+	}
+	extra := header[fixedHeaderLen : fixedHeaderLen+xlen]
+	for len(extra) >= 4 {
+		slen := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+slen {
+			break
+		}
+		if extra[0] == 'B' && extra[1] == 'C' && slen == 2 {
+			return int(binary.LittleEndian.Uint16(extra[4:6])) + 1, fixedHeaderLen + xlen, nil
+		}
+		extra = extra[4+slen:]
+	}
+	return 0, 0, ErrNotBGZF
+}
+
+// readBlockHeader reads the header of the block at off in r.
+func readBlockHeader(r io.ReaderAt, off int64) (blockSize, headerLen int, err error) {
+	var buf [fixedHeaderLen + 256]byte
+	n, err := r.ReadAt(buf[:], off)
+	if n == 0 {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, 0, err
+	}
+	return parseHeader(buf[:n])
+}
+
+// readBlock decompresses the block at off in r, appending its data to dst. It
+// returns the extended dst and the compressed size of the block.
+func readBlock(dst []byte, r io.ReaderAt, off int64) ([]byte, int, error) {
+	blockSize, headerLen, err := readBlockHeader(r, off)
+	if err != nil {
+		return dst, 0, err
+	}
+	block := make([]byte, blockSize)
+	if _, err := r.ReadAt(block, off); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return dst, 0, err
+	}
+	dst, err = inflateBlock(dst, block, headerLen)
+	if err != nil {
+		return dst, 0, err
+	}
+	return dst, blockSize, nil
+}
+
+// inflateBlock decompresses a whole block, whose gzip header is headerLen
+// long, appending its data to dst.
+func inflateBlock(dst, block []byte, headerLen int) ([]byte, error) {
+	blockSize := len(block)
+	if blockSize < headerLen+8 {
+		return dst, ErrCorrupt
+	}
+	trailer := block[blockSize-8:]
+	sum := binary.LittleEndian.Uint32(trailer[:4])
+	size := int(binary.LittleEndian.Uint32(trailer[4:]))
+	if size > MaxBlockSize {
+		return dst, ErrCorrupt
+	}
+
+	start := len(dst)
+	dst = append(dst, make([]byte, size)...)
+	inflater := flate.NewReader(bytes.NewReader(block[headerLen : blockSize-8]))
+	defer inflater.Close()
+	if _, err := io.ReadFull(inflater, dst[start:]); err != nil {
+		return dst[:start], fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if crc32.ChecksumIEEE(dst[start:]) != sum {
+		return dst[:start], ErrChecksum
+	}
+	return dst, nil
+}
+
+// blockSizes returns the compressed and uncompressed sizes of the block at off
+// without decompressing it.
+func blockSizes(r io.ReaderAt, off int64) (compressed, uncompressed int, err error) {
+	blockSize, _, err := readBlockHeader(r, off)
+	if err != nil {
+		return 0, 0, err
+	}
+	var isize [4]byte
+	if _, err := r.ReadAt(isize[:], off+int64(blockSize)-4); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, 0, err
+	}
+	return blockSize, int(binary.LittleEndian.Uint32(isize[:])), nil
+}
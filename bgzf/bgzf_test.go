@@ -0,0 +1,197 @@
+package bgzf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// testData returns n bytes that compress well if text is set, and hardly at
+// all otherwise.
+func testData(n int, text bool) []byte {
+	rng := rand.New(rand.NewSource(int64(n)))
+	b := make([]byte, n)
+	for i := range b {
+		if text {
+			b[i] = "ACGT\n"[rng.Intn(5)]
+		} else {
+			b[i] = byte(rng.Intn(256))
+		}
+	}
+	return b
+}
+
+func compress(t *testing.T, data []byte, chunk int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for p := data; len(p) > 0; {
+		n := min(chunk, len(p))
+		if m, err := w.Write(p[:n]); err != nil || m != n {
+			t.Fatalf("Write: wrote %d of %d bytes: %v", m, n, err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriterReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		text  bool
+		chunk int
+	}{
+		{"empty", 0, true, 1},
+		{"one byte", 1, true, 1},
+		{"just under a block", blockDataSize - 1, true, 4096},
+		{"one block", blockDataSize, true, blockDataSize},
+		{"just over a block", blockDataSize + 1, true, 1000},
+		{"several blocks", 3*blockDataSize + 17, true, 1 << 20},
+		{"incompressible", 2*blockDataSize + 5, false, 7777},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testData(tt.size, tt.text)
+			compressed := compress(t, data, tt.chunk)
+			if !bytes.HasSuffix(compressed, eofBlock) {
+				t.Errorf("output doesn't end with the EOF block")
+			}
+			if !IsBGZF(compressed) {
+				t.Errorf("IsBGZF = false")
+			}
+
+			got, err := io.ReadAll(NewReader(bytes.NewReader(compressed)))
+			if err != nil {
+				t.Fatalf("Reader: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Reader returned %d bytes, want the %d written", len(got), len(data))
+			}
+
+			// BGZF is valid multi-member gzip.
+			zr, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("gzip.NewReader: %v", err)
+			}
+			if got, err := io.ReadAll(zr); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("gzip read %d bytes, want %d: %v", len(got), len(data), err)
+			}
+		})
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write([]byte("ACGT"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	first := buf.Len()
+	w.Write([]byte("TTTT"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := BuildIndex(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Index{{uint64(first), 4}}
+	if len(index) != 1 || index[0] != want[0] {
+		t.Errorf("index = %v, want %v", index, want)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	valid := compress(t, []byte("ACGTACGTACGT"), 100)
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	zw.Write([]byte("ACGT"))
+	zw.Close()
+	badCRC := bytes.Clone(valid)
+	badCRC[len(valid)-len(eofBlock)-8] ^= 0xff
+	hugeExtra := bytes.Clone(valid[:fixedHeaderLen])
+	hugeExtra[10], hugeExtra[11] = 0xff, 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not gzip", []byte("ACGT\n"), ErrNotBGZF},
+		{"plain gzip", plain.Bytes(), ErrNotBGZF},
+		{"truncated header", valid[:5], ErrCorrupt},
+		{"truncated block", valid[:30], ErrCorrupt},
+		{"extra field too long", hugeExtra, ErrCorrupt},
+		{"bad checksum", badCRC, ErrChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := io.ReadAll(NewReader(bytes.NewReader(tt.data)))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReaderAt(t *testing.T) {
+	data := testData(3*blockDataSize+100, true)
+	compressed := compress(t, data, 1<<20)
+	index, err := BuildIndex(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 3 {
+		t.Fatalf("index has %d entries, want 3", len(index))
+	}
+
+	// The index survives a round trip through the .gzi format.
+	var gzi bytes.Buffer
+	if err := index.Write(&gzi); err != nil {
+		t.Fatal(err)
+	}
+	if gzi.Len() != 8+16*len(index) {
+		t.Errorf(".gzi is %d bytes, want %d", gzi.Len(), 8+16*len(index))
+	}
+	index, err = ReadIndex(&gzi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReaderAt(bytes.NewReader(compressed), index)
+	tests := []struct {
+		name    string
+		off     int64
+		n       int
+		wantN   int
+		wantErr error
+	}{
+		{"start", 0, 10, 10, nil},
+		{"within a block", 1000, 500, 500, nil},
+		{"across a boundary", blockDataSize - 3, 10, 10, nil},
+		{"across two boundaries", blockDataSize - 3, blockDataSize + 10, blockDataSize + 10, nil},
+		{"last block", 3 * blockDataSize, 100, 100, nil},
+		{"past the end", 3*blockDataSize + 50, 100, 50, io.EOF},
+		{"negative offset", -1, 10, 0, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.n)
+			n, err := r.ReadAt(p, tt.off)
+			if n != tt.wantN || err != tt.wantErr {
+				t.Fatalf("ReadAt = %d, %v, want %d, %v", n, err, tt.wantN, tt.wantErr)
+			}
+			if n > 0 && !bytes.Equal(p[:n], data[tt.off:tt.off+int64(n)]) {
+				t.Errorf("ReadAt returned the wrong bytes")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package bgzf
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Offset pairs the compressed offset of a block with the uncompressed offset
+// of its first byte.
+type Offset struct {
+	Compressed   uint64
+	Uncompressed uint64
+}
+
+// Index locates the blocks of a BGZF file, as stored in the .gzi files written
+// by bgzip -i. The first block, at offset 0, is implicit.
+type Index []Offset
+
+// BuildIndex indexes the BGZF data in the first size bytes of r by reading the
+// block headers and trailers.
+func BuildIndex(r io.ReaderAt, size int64) (Index, error) {
+	var index Index
+	var compressed, uncompressed uint64
+	for int64(compressed) < size {
+		c, u, err := blockSizes(r, int64(compressed))
+		if err != nil {
+			return nil, err
+		}
+		if compressed > 0 && u > 0 {
+			index = append(index, Offset{compressed, uncompressed})
+		}
+		compressed += uint64(c)
+		uncompressed += uint64(u)
+	}
+	return index, nil
+}
+
+// ReadIndex reads a .gzi index: the number of entries, then each entry's
+// compressed and uncompressed offsets, all as little-endian uint64s.
+func ReadIndex(r io.Reader) (Index, error) {
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+	index := make(Index, 0, min(n, 1<<20))
+	for i := uint64(0); i < n; i++ {
+		var o Offset
+		if err := binary.Read(r, binary.LittleEndian, &o); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		index = append(index, o)
+	}
+	return index, nil
+}
+
+// Write writes the index in .gzi format.
+func (index Index) Write(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(index))); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, []Offset(index))
+}
+
+// ReaderAt provides random access to the uncompressed data of a BGZF file,
+// using its Index, which must list every block. It caches the last block read,
+// and is safe for concurrent use.
+type ReaderAt struct {
+	r      io.ReaderAt
+	blocks Index // all blocks, including the first
+
+	mu         sync.Mutex
+	cached     int // index in blocks of the cached block, or -1
+	cachedData []byte
+}
+
+// NewReaderAt returns a ReaderAt reading the BGZF data of r.
+func NewReaderAt(r io.ReaderAt, index Index) *ReaderAt {
+	blocks := make(Index, 0, len(index)+1)
+	blocks = append(blocks, Offset{0, 0})
+	blocks = append(blocks, index...)
+	return &ReaderAt{r: r, blocks: blocks, cached: -1}
+}
+
+// block returns the uncompressed data of block i.
+func (b *ReaderAt) block(i int) ([]byte, error) {
+	if i == b.cached {
+		return b.cachedData, nil
+	}
+	data, _, err := readBlock(b.cachedData[:0], b.r, int64(b.blocks[i].Compressed))
+	if err != nil {
+		b.cached = -1
+		return nil, err
+	}
+	b.cached, b.cachedData = i, data
+	return data, nil
+}
+
+// ReadAt reads len(p) bytes of uncompressed data from offset off.
+func (b *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The block holding off is the last one starting at or before it.
+	i := sort.Search(len(b.blocks), func(i int) bool {
+		return b.blocks[i].Uncompressed > uint64(off)
+	}) - 1
+	if i < 0 || off < 0 {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) {
+		if i == len(b.blocks) {
+			return n, io.EOF
+		}
+		data, err := b.block(i)
+		if err != nil {
+			return n, err
+		}
+		skip := off + int64(n) - int64(b.blocks[i].Uncompressed)
+		if skip < int64(len(data)) {
+			n += copy(p[n:], data[skip:])
+		}
+		i++
+	}
+	return n, nil
+}
@@ -0,0 +1,71 @@
+package bgzf
+
+import (
+	"io"
+)
+
+// Reader decompresses a BGZF stream block by block, as a plain gzip reader
+// would, checking each block's checksum.
+type Reader struct {
+	r     io.Reader
+	block []byte
+	data  []byte
+	pos   int
+	err   error
+}
+
+// NewReader returns a Reader decompressing the BGZF data read from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, block: make([]byte, MaxBlockSize)}
+}
+
+// Read reads uncompressed data, returning io.EOF at the end of the last
+// block.
+func (b *Reader) Read(p []byte) (int, error) {
+	for b.pos == len(b.data) {
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.err = b.next()
+	}
+	n := copy(p, b.data[b.pos:])
+	b.pos += n
+	return n, nil
+}
+
+// next reads and decompresses the next block.
+func (b *Reader) next() error {
+	header := b.block[:fixedHeaderLen]
+	n, err := io.ReadFull(b.r, header)
+	if err == io.EOF {
+		return err
+	}
+	// BGZF blocks are gzip members with an extra field (flag 4).
+	if !IsGzip(header[:n]) || (n > 3 && header[3]&4 == 0) {
+		return ErrNotBGZF
+	}
+	if err != nil {
+		return ErrCorrupt
+	}
+	// The extra field, which holds the block size, follows the fixed header.
+	xlen := int(header[10]) | int(header[11])<<8
+	if fixedHeaderLen+xlen > len(b.block) {
+		return ErrCorrupt
+	}
+	if _, err := io.ReadFull(b.r, b.block[fixedHeaderLen:fixedHeaderLen+xlen]); err != nil {
+		return ErrCorrupt
+	}
+	blockSize, headerLen, err := parseHeader(b.block[:fixedHeaderLen+xlen])
+	if err != nil {
+		return err
+	}
+	if blockSize < headerLen {
+		return ErrCorrupt
+	}
+	if _, err := io.ReadFull(b.r, b.block[headerLen:blockSize]); err != nil {
+		return ErrCorrupt
+	}
+	b.data, err = inflateBlock(b.data[:0], b.block[:blockSize], headerLen)
+	b.pos = 0
+	return err
+}
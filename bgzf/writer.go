@@ -0,0 +1,86 @@
+package bgzf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// blockDataSize is the amount of data compressed into each block, small
+// enough that the compressed block always fits in MaxBlockSize.
+const blockDataSize = 0xff00
+
+// eofBlock is the empty block ending BGZF files, which samtools and htslib
+// look for to tell a complete file from a truncated one.
+var eofBlock = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43,
+	0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// Writer compresses data into BGZF blocks.
+type Writer struct {
+	w          io.Writer
+	data       []byte
+	compressed bytes.Buffer
+	compressor *flate.Writer
+	err        error
+}
+
+// NewWriter returns a Writer writing BGZF data to w.
+func NewWriter(w io.Writer) *Writer {
+	compressor, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return &Writer{w: w, data: make([]byte, 0, blockDataSize), compressor: compressor}
+}
+
+// Write buffers p, writing out every block it fills.
+func (b *Writer) Write(p []byte) (int, error) {
+	n := 0
+	for b.err == nil && len(p) > 0 {
+		m := copy(b.data[len(b.data):blockDataSize], p)
+		b.data = b.data[:len(b.data)+m]
+		p = p[m:]
+		n += m
+		if len(b.data) == blockDataSize {
+			b.err = b.Flush()
+		}
+	}
+	return n, b.err
+}
+
+// Flush writes any buffered data as a block, so that data written next
+// starts a new block.
+func (b *Writer) Flush() error {
+	if b.err != nil || len(b.data) == 0 {
+		return b.err
+	}
+	b.compressed.Reset()
+	header := [18]byte{0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff, 6, 0, 'B', 'C', 2, 0}
+	b.compressed.Write(header[:])
+	b.compressor.Reset(&b.compressed)
+	b.compressor.Write(b.data)
+	if b.err = b.compressor.Close(); b.err != nil {
+		return b.err
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], crc32.ChecksumIEEE(b.data))
+	binary.LittleEndian.PutUint32(trailer[4:], uint32(len(b.data)))
+	b.compressed.Write(trailer[:])
+
+	block := b.compressed.Bytes()
+	binary.LittleEndian.PutUint16(block[16:18], uint16(len(block)-1))
+	_, b.err = b.w.Write(block)
+	b.data = b.data[:0]
+	return b.err
+}
+
+// Close writes any buffered data and the end-of-file block. It doesn't close
+// the underlying writer.
+func (b *Writer) Close() error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	_, b.err = b.w.Write(eofBlock)
+	return b.err
+}
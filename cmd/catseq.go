@@ -10,6 +10,9 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"strings"
+	"sync"
+
+	"github.com/eernst/catseq/seqfile"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -53,17 +56,28 @@ var LineWrap int
 
 const (
 	// Supported sequence file formats
-	FastaFormat   string = "fasta"
-	FastqFormat          = "fastq"
+	FastaFormat   string = seqfile.FASTA
+	FastqFormat          = seqfile.FASTQ
+	TsvFormat            = seqfile.TSV
+	JsonlFormat          = seqfile.JSONL
+	SamFormat            = seqfile.SAM
+	BamFormat            = seqfile.BAM
+	TwoBitFormat         = seqfile.TWOBIT
+	GenbankFormat        = seqfile.GENBANK
+	EmblFormat           = seqfile.EMBL
 	UnknownFormat        = "unknown"
 )
 
+// seqFormatsHelp ends the help of commands reading sequence files.
+const seqFormatsHelp = `Input may be FASTA, FASTQ, GenBank, EMBL, SAM, BAM, 2bit, TSV or JSONL (see
+catseq convert), optionally compressed, and its format is guessed from the
+file extension, or from the contents for input piped in on STDIN.`
+
+// GuessFileFormat guesses the format of a file from its extension, as
+// seqfile.FormatOf does, or returns UnknownFormat.
 func GuessFileFormat(filename string) (format string, err error) {
-	switch filepath.Ext(strings.ToLower(filename)) {
-	case ".fastq", ".fq":
-		return FastqFormat, nil
-	case ".fasta", ".fa", ".fna", ".faa":
-		return FastaFormat, nil
+	if format := seqfile.FormatOf(filename); format != "" {
+		return format, nil
 	}
 	fmt.Fprintf(os.Stderr, "Unknown file format: %s\n", filepath.Ext(strings.ToLower(filename)))
 	return UnknownFormat, nil
@@ -179,6 +193,42 @@ func initConfig() {
 
 func check(e error) {
 	if e != nil {
+		removeTempFiles()
 		log.Fatal(e)
 	}
 }
+
+// tempFiles holds the temporary files in use, which check removes before
+// exiting so that failed commands don't leave them behind.
+var tempFiles = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// createTemp creates a temporary file as os.CreateTemp does, to be removed by
+// removeTemp, or by check on failure.
+func createTemp(dir, pattern string) (*os.File, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err == nil {
+		tempFiles.Lock()
+		tempFiles.names[f.Name()] = true
+		tempFiles.Unlock()
+	}
+	return f, err
+}
+
+// removeTemp removes a temporary file made by createTemp.
+func removeTemp(fileName string) error {
+	tempFiles.Lock()
+	delete(tempFiles.names, fileName)
+	tempFiles.Unlock()
+	return os.Remove(fileName)
+}
+
+func removeTempFiles() {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	for fileName := range tempFiles.names {
+		os.Remove(fileName)
+	}
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eernst/catseq/annot"
+	"github.com/eernst/catseq/seqfile"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().StringP("from", "f", "", "Input format, one of "+strings.Join(seqfile.InputFormats, ", ")+". (default guessed from the file name or contents)")
+	convertCmd.Flags().StringP("to", "t", "", "Output format, one of "+strings.Join(seqfile.OutputFormats, ", ")+".")
+	convertCmd.Flags().IntP("fake-qual", "Q", 40, "Phred quality given to bases of records without qualities when writing FASTQ.")
+	convertCmd.Flags().BoolP("drop-qual", "", false, "Drop qualities from TSV, JSONL, SAM or BAM output.")
+	convertCmd.Flags().StringP("gff", "", "", "Write the features of GenBank or EMBL input to this GFF3 file.")
+	convertCmd.Flags().StringP("sam-tags", "", strings.Join(seqfile.SAMTags, ","), "Comma-separated SAM tags carried between SAM or BAM records and descriptions, or \"\" for none.")
+}
+
+func validSeqFormat(format string, formats []string) bool {
+	for _, f := range formats {
+		if format == f {
+			return true
+		}
+	}
+	return false
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert --to FORMAT [SEQUENCE_FILE]",
+	Short: "Convert sequence files between formats.",
+	Long: `
+
+convert reads records in one format and writes them in another:
+
+  fasta   FASTA, wrapped at --wrap bases per line if given
+  fastq   FASTQ
+  tsv     one record per line with tab-separated header line, sequence and,
+          for records with qualities, quality columns; with --print-header
+          the first line gives the column names name, seq and qual
+  jsonl   one JSON object per line with "name", "seq" and, for records with
+          qualities, "qual" members
+  sam     unaligned SAM, with the ID as the read name, "/1" and "/2" IDs
+          as paired reads, and the description in tags (see below)
+  bam     unaligned BAM, as SAM, compressed with BGZF
+  2bit    UCSC 2bit, with records named by their IDs, lower case bases
+          soft-masked and bases other than A, C, G and T stored as N; the
+          whole file is held in memory, packed, until the end of the input
+
+GenBank and EMBL flat files can be read too, giving records named after
+their accession.version and DEFINITION (or DE) lines. Their sequences are
+upper-cased, and --gff writes their feature tables as GFF3, with qualifiers
+as attributes, the "source" feature as a region, and features joined from
+several parts (e.g. spliced CDSs) as one line per part sharing an ID, in the
+order of the location. Parts past the origin of a circular sequence end after
+the sequence, as GFF3 has it, and its region gets Is_circular=true.
+
+2bit files are read in the order of their index, with masked bases in lower
+case.
+
+The input format is guessed from the file name, ignoring compression
+extensions, or else from the contents (as it must be for STDIN) unless given
+with --from.
+
+FASTA output drops qualities, and FASTQ output gives records without
+qualities the Phred quality --fake-qual for every base. --drop-qual drops
+qualities from the other formats too.
+
+SAM and BAM input is read as reads in their original orientation: reads
+mapped to the reverse strand are reverse complemented back, secondary and
+supplementary alignments are skipped, and paired reads get "/1" or "/2"
+appended to their names. The tags listed by --sam-tags (by default the read
+group RG and barcode BC) are carried into the description as in SAM, e.g.
+"RG:Z:lane1 BC:Z:ACGTACGT", followed by any CO tag comment. Other commands
+read SAM and BAM the same way with the default tags.
+
+When writing SAM or BAM, words of the description that are valid tags listed
+by --sam-tags become tags again, and the rest of the description a CO tag.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		flags := cmd.Flags()
+		from, err := flags.GetString("from")
+		check(err)
+		to, err := flags.GetString("to")
+		check(err)
+		fakeQual, err := flags.GetInt("fake-qual")
+		check(err)
+		dropQual, err := flags.GetBool("drop-qual")
+		check(err)
+		gffFileName, err := flags.GetString("gff")
+		check(err)
+		samTags, err := flags.GetString("sam-tags")
+		check(err)
+
+		if to == "" {
+			fmt.Fprintf(os.Stderr, "Error: No output format given with --to.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if from != "" && !validSeqFormat(from, seqfile.InputFormats) {
+			fmt.Fprintf(os.Stderr, "Error: Unknown input format %q.\n", from)
+			os.Exit(1)
+		}
+		if !validSeqFormat(to, seqfile.OutputFormats) {
+			fmt.Fprintf(os.Stderr, "Error: Unknown output format %q.\n", to)
+			os.Exit(1)
+		}
+		if fakeQual < 0 || fakeQual > 93 {
+			fmt.Fprintf(os.Stderr, "Error: --fake-qual must be between 0 and 93.\n")
+			os.Exit(1)
+		}
+
+		var seqsInFileName string
+		switch len(args) {
+		case 0:
+			seqsInFileName = "-"
+			fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
+		case 1:
+			seqsInFileName = args[0]
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Wrong number of positional arguments given.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		seqfile.SAMTags = nil
+		for _, tag := range strings.Split(samTags, ",") {
+			if tag = strings.TrimSpace(tag); tag == "" {
+				continue
+			}
+			if len(tag) != 2 {
+				fmt.Fprintf(os.Stderr, "Error: Invalid SAM tag %q.\n", tag)
+				os.Exit(1)
+			}
+			seqfile.SAMTags = append(seqfile.SAMTags, tag)
+		}
+
+		seq.ValidateSeq = false
+		reader, err := seqfile.NewReader(seqsInFileName, from)
+		check(err)
+		defer reader.Close()
+
+		writer, err := xopen.Wopen("-") // "-" for STDOUT
+		check(err)
+		defer writer.Close()
+		if to == TsvFormat && PrintHeader {
+			fmt.Fprintf(writer, "name\tseq\tqual\n")
+		}
+		out, err := seqfile.NewWriter(writer, to, LineWrap)
+		check(err)
+
+		var features seqfile.FeatureReader
+		var gffWriter *xopen.Writer
+		if gffFileName != "" {
+			var ok bool
+			if features, ok = reader.(seqfile.FeatureReader); !ok {
+				fmt.Fprintf(os.Stderr, "Error: --gff needs GenBank or EMBL input.\n")
+				os.Exit(1)
+			}
+			gffWriter, err = xopen.Wopen(gffFileName)
+			check(err)
+			defer gffWriter.Close()
+			fmt.Fprintf(gffWriter, "##gff-version 3\n")
+		}
+
+		var n int
+		for {
+			rec, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			check(err)
+			if gffWriter != nil {
+				fmt.Fprintf(gffWriter, "##sequence-region %s 1 %d\n", rec.ID, len(rec.Seq.Seq))
+				for _, f := range features.Features() {
+					check(annot.WriteGFF3(gffWriter, f))
+				}
+			}
+			// The reader may reuse the record, so change a copy.
+			switch {
+			case to == FastqFormat && len(rec.Seq.Qual) == 0:
+				rec = rec.Clone()
+				rec.Seq.Qual = bytes.Repeat([]byte{byte(33 + fakeQual)}, len(rec.Seq.Seq))
+			case dropQual && len(rec.Seq.Qual) > 0:
+				rec = rec.Clone()
+				rec.Seq.Qual = nil
+			}
+			check(out.Write(rec))
+			n++
+		}
+		check(out.Close())
+
+		if Verbose {
+			fmt.Fprintf(os.Stderr, "Converted %d records.\n", n)
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/eernst/catseq/digest"
+	"github.com/eernst/catseq/pipeline"
+	"github.com/eernst/catseq/seqmath"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	DedupBySeq   string = "seq"
+	DedupByName         = "name"
+	DedupBySeqRC        = "seq-rc"
+)
+
+func init() {
+	RootCmd.AddCommand(dedupCmd)
+	dedupCmd.Flags().StringP("by", "b", DedupBySeq, "What makes records duplicates. One of \"seq\", \"name\", or \"seq-rc\" (sequence or its reverse complement).")
+	dedupCmd.Flags().BoolP("ignore-case", "i", false, "Ignore case when comparing sequences.")
+	dedupCmd.Flags().IntP("hash-bits", "", 128, "Size of the digest kept per unique record, 64 or 128 bits.")
+	dedupCmd.Flags().BoolP("keep-best", "", false, "Keep the copy with the highest mean base quality instead of the first.")
+	dedupCmd.Flags().IntP("max-mismatches", "", 0, "Also treat sequences of the same length differing at up to this many positions as duplicates.")
+	dedupCmd.Flags().StringP("spill-dir", "", "", "Partition records into temporary files in this directory to bound memory use. Output order is not preserved.")
+	dedupCmd.Flags().IntP("spill-parts", "", 64, "Number of temporary partitions used with --spill-dir.")
+	addPairedOutputFlags(dedupCmd, "unique")
+}
+
+type dedupOptions struct {
+	by            string
+	ignoreCase    bool
+	hashBits      int
+	keepBest      bool
+	maxMismatches int
+}
+
+// dedupEntry is the copy of a duplicate set currently kept with --keep-best.
+type dedupEntry struct {
+	index int
+	qual  float64
+	set   []*fastx.Record
+}
+
+// nearEntry is a duplicate set found with --max-mismatches. Later record sets
+// are compared with the sequences of its first copy.
+type nearEntry struct {
+	dedupEntry
+	order   int
+	seqs    [][]byte
+	checked int
+}
+
+// dedupper tracks the digests of the records seen so far, or with
+// --max-mismatches the sequences of the first copy of each duplicate set,
+// indexed by segment. Each record set is a single read, or a read pair for
+// paired input.
+type dedupper struct {
+	opts     *dedupOptions
+	seen64   map[uint64]struct{}
+	seen128  map[[2]uint64]struct{}
+	best     map[[2]uint64]*dedupEntry
+	near     []*nearEntry
+	segments map[[2]uint64][]*nearEntry
+	queries  int
+	buf      []byte
+	in       int
+	unique   int
+}
+
+func newDedupper(opts *dedupOptions) *dedupper {
+	d := &dedupper{opts: opts}
+	switch {
+	case opts.maxMismatches > 0:
+		d.segments = make(map[[2]uint64][]*nearEntry)
+	case opts.keepBest:
+		d.best = make(map[[2]uint64]*dedupEntry)
+	case opts.hashBits == 64:
+		d.seen64 = make(map[uint64]struct{})
+	default:
+		d.seen128 = make(map[[2]uint64]struct{})
+	}
+	return d
+}
+
+func (d *dedupper) normalize(s []byte) []byte {
+	if d.opts.ignoreCase {
+		return bytes.ToUpper(s)
+	}
+	return s
+}
+
+// key returns the digest identifying the duplicate set of a record set.
+func (d *dedupper) key(set []*fastx.Record) [2]uint64 {
+	d.buf = d.buf[:0]
+	switch d.opts.by {
+	case DedupByName:
+		d.buf = append(d.buf, set[0].ID...)
+	case DedupBySeqRC:
+		if len(set) == 2 {
+			// The same fragment sequenced from the other strand swaps the mates.
+			a, b := d.normalize(set[0].Seq.Seq), d.normalize(set[1].Seq.Seq)
+			if bytes.Compare(b, a) < 0 {
+				a, b = b, a
+			}
+			d.buf = append(append(append(d.buf, a...), 0), b...)
+		} else {
+			s := d.normalize(set[0].Seq.Seq)
+			rc := seqmath.ReverseComplement(s, seqmath.IsRNA(s))
+			if bytes.Compare(rc, s) < 0 {
+				s = rc
+			}
+			d.buf = append(d.buf, s...)
+		}
+	default:
+		for i, rec := range set {
+			if i > 0 {
+				d.buf = append(d.buf, 0)
+			}
+			d.buf = append(d.buf, d.normalize(rec.Seq.Seq)...)
+		}
+	}
+	if d.opts.hashBits == 64 {
+		return [2]uint64{digest.XXH64(d.buf, 0), 0}
+	}
+	return digest.XXH64x2(d.buf)
+}
+
+// add records a set, passing it to emit if it is the first of its duplicate
+// set. With keep-best nothing is emitted until flush.
+func (d *dedupper) add(set []*fastx.Record, emit func([]*fastx.Record)) {
+	if d.segments != nil {
+		d.addNear(set, emit)
+		return
+	}
+	k := d.key(set)
+	d.in++
+	switch {
+	case d.best != nil:
+		q := meanSetQuality(set)
+		if e, ok := d.best[k]; !ok {
+			d.best[k] = &dedupEntry{index: d.in, qual: q, set: set}
+			d.unique++
+		} else if q > e.qual {
+			e.index, e.qual, e.set = d.in, q, set
+		}
+	case d.seen64 != nil:
+		if _, ok := d.seen64[k[0]]; !ok {
+			d.seen64[k[0]] = struct{}{}
+			d.unique++
+			emit(set)
+		}
+	default:
+		if _, ok := d.seen128[k]; !ok {
+			d.seen128[k] = struct{}{}
+			d.unique++
+			emit(set)
+		}
+	}
+}
+
+// addNear records a set with --max-mismatches, adding it to the first
+// duplicate set whose first copy has the same lengths and differs at no more
+// than max-mismatches positions, or starting a new one.
+func (d *dedupper) addNear(set []*fastx.Record, emit func([]*fastx.Record)) {
+	seqs := make([][]byte, len(set))
+	for i, rec := range set {
+		seqs[i] = d.normalize(rec.Seq.Seq)
+	}
+	e := d.findNear(seqs)
+	if e == nil && d.opts.by == DedupBySeqRC {
+		e = d.findNear(otherStrand(seqs))
+	}
+	d.in++
+	if e == nil {
+		e = &nearEntry{dedupEntry: dedupEntry{index: d.in}, order: len(d.near), seqs: seqs}
+		d.near = append(d.near, e)
+		for _, k := range d.segmentKeys(seqs) {
+			d.segments[k] = append(d.segments[k], e)
+		}
+		d.unique++
+		if !d.opts.keepBest {
+			emit(set)
+			return
+		}
+		e.qual, e.set = meanSetQuality(set), set
+		return
+	}
+	if d.opts.keepBest {
+		if q := meanSetQuality(set); q > e.qual {
+			e.index, e.qual, e.set = d.in, q, set
+		}
+	}
+}
+
+// otherStrand returns the sequences of a record set as read from the other
+// strand: the reverse complement of a single read, or a pair with its mates
+// swapped.
+func otherStrand(seqs [][]byte) [][]byte {
+	if len(seqs) == 2 {
+		return [][]byte{seqs[1], seqs[0]}
+	}
+	return [][]byte{seqmath.ReverseComplement(seqs[0], seqmath.IsRNA(seqs[0]))}
+}
+
+// segmentKeys splits the sequences of a set, joined, into max-mismatches+1
+// segments and returns their digests, which also cover the position of each
+// segment and the lengths of the sequences. Sets within max-mismatches of each
+// other share at least one segment.
+func (d *dedupper) segmentKeys(seqs [][]byte) [][2]uint64 {
+	joined := bytes.Join(seqs, nil)
+	n := d.opts.maxMismatches + 1
+	keys := make([][2]uint64, n)
+	for i := range keys {
+		d.buf = d.buf[:0]
+		for _, s := range seqs {
+			d.buf = binary.LittleEndian.AppendUint64(d.buf, uint64(len(s)))
+		}
+		d.buf = binary.LittleEndian.AppendUint64(d.buf, uint64(i))
+		d.buf = append(d.buf, joined[i*len(joined)/n:(i+1)*len(joined)/n]...)
+		keys[i] = digest.XXH64x2(d.buf)
+	}
+	return keys
+}
+
+// findNear returns the first duplicate set within max-mismatches of seqs, if
+// any, comparing only with sets sharing a segment.
+func (d *dedupper) findNear(seqs [][]byte) *nearEntry {
+	d.queries++
+	var found *nearEntry
+	for _, k := range d.segmentKeys(seqs) {
+		for _, e := range d.segments[k] {
+			if e.checked == d.queries || (found != nil && found.order <= e.order) {
+				continue
+			}
+			e.checked = d.queries
+			if withinMismatches(e.seqs, seqs, d.opts.maxMismatches) {
+				found = e
+			}
+		}
+	}
+	return found
+}
+
+// withinMismatches reports whether two sets of sequences have the same
+// lengths and differ at no more than max positions in all.
+func withinMismatches(a, b [][]byte, max int) bool {
+	var mismatches int
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				if mismatches++; mismatches > max {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// flush emits the kept copies, in input order, when using keep-best.
+func (d *dedupper) flush(emit func([]*fastx.Record)) {
+	if !d.opts.keepBest {
+		return
+	}
+	entries := make([]*dedupEntry, 0, len(d.best)+len(d.near))
+	for _, e := range d.best {
+		entries = append(entries, e)
+	}
+	for _, e := range d.near {
+		entries = append(entries, &e.dedupEntry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].index < entries[j].index })
+	for _, e := range entries {
+		emit(e.set)
+	}
+	if d.best != nil {
+		d.best = make(map[[2]uint64]*dedupEntry)
+	}
+	d.near = nil
+	if d.segments != nil {
+		d.segments = make(map[[2]uint64][]*nearEntry)
+	}
+}
+
+func meanSetQuality(set []*fastx.Record) float64 {
+	var sumQ, length int
+	for _, rec := range set {
+		s := rec.Seq
+		if len(s.Qual) == 0 {
+			continue
+		}
+		if len(s.QualValue) <= 0 {
+			vals, err := seq.QualityValue(seq.Sanger, s.Qual)
+			check(err)
+			s.QualValue = vals
+		}
+		for _, q := range s.QualValue {
+			sumQ += q
+		}
+		length += s.Length()
+	}
+	if length == 0 {
+		return 0
+	}
+	return float64(sumQ) / float64(length)
+}
+
+// spillPartitions writes each record set to one of n temporary files chosen
+// by its digest, so that all copies of a duplicate set share a partition.
+// The files are removed by check if anything fails.
+func spillPartitions(readers []pipeline.RecordReader, d *dedupper, dir string, n int) (files []string) {
+	writers := make([]*xopen.Writer, n)
+	for i := range writers {
+		f, err := createTemp(dir, fmt.Sprintf("catseq-dedup-%04d-*.fx", i))
+		check(err)
+		f.Close()
+		files = append(files, f.Name())
+		writers[i], err = xopen.Wopen(f.Name())
+		check(err)
+	}
+	for {
+		set, err := pipeline.ReadRecSet(readers...)
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		k := d.key(set)
+		w := writers[k[0]%uint64(n)]
+		for _, rec := range set {
+			rec.FormatToWriter(w, 0)
+		}
+	}
+	for _, w := range writers {
+		check(w.Close())
+	}
+	return files
+}
+
+// readSets reads consecutive groups of size records from a partition file.
+func readSets(fileName string, size int, each func([]*fastx.Record)) {
+	reader, err := fastx.NewDefaultReader(fileName)
+	check(err)
+	defer reader.Close()
+	for {
+		set := make([]*fastx.Record, size)
+		for i := range set {
+			rec, err := reader.Read()
+			if err == io.EOF {
+				return
+			}
+			check(err)
+			set[i] = rec.Clone()
+		}
+		each(set)
+	}
+}
+
+var dedupCmd = &cobra.Command{
+	Use:   "dedup [SEQUENCE_FILE [SEQUENCE_FILE_R2]]",
+	Short: "Remove duplicate sequences from (multi-)sequence files.",
+	Long: `
+
+dedup removes duplicate records, keeping the first copy of each (or the copy
+with the highest mean base quality with --keep-best). Records are duplicates
+when they have the same sequence, the same name, or, with --by seq-rc, when one
+is the reverse complement of the other.
+
+With --max-mismatches, near-duplicates count as well: records whose sequences
+have the same length and differ at no more than that many positions, e.g. PCR
+duplicates with sequencing errors. Each record joins the first duplicate set
+whose first copy it is that close to, or else starts a new one. Sequences are
+split into max-mismatches+1 segments, one of which near-duplicates must share,
+so that each record is only compared with the sets sharing one; the first
+copy of every set is held in memory, and --spill-dir can't be used.
+
+Otherwise only a 64 or 128-bit xxHash digest is kept per unique record. For
+inputs with too many unique records to fit in memory, --spill-dir partitions
+the records into temporary files by digest and deduplicates each partition in
+turn. Note that --keep-best holds every unique record in memory until the end
+of the input (or of each partition).
+
+Given two files, they are treated as R1/R2 of paired-end reads: pairs are
+duplicates when both mates match (for seq-rc, in either order), with up to
+--max-mismatches over both mates together, and unique pairs are written to
+--out and --out2. The duplication rate is reported on STDERR.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		flags := cmd.Flags()
+		opts := &dedupOptions{}
+		var err error
+		opts.by, err = flags.GetString("by")
+		check(err)
+		opts.ignoreCase, err = flags.GetBool("ignore-case")
+		check(err)
+		opts.hashBits, err = flags.GetInt("hash-bits")
+		check(err)
+		opts.keepBest, err = flags.GetBool("keep-best")
+		check(err)
+		opts.maxMismatches, err = flags.GetInt("max-mismatches")
+		check(err)
+		spillDir, err := flags.GetString("spill-dir")
+		check(err)
+		spillParts, err := flags.GetInt("spill-parts")
+		check(err)
+
+		switch opts.by {
+		case DedupBySeq, DedupByName, DedupBySeqRC:
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Unknown duplicate criterion %q.\n", opts.by)
+			os.Exit(1)
+		}
+		if opts.hashBits != 64 && opts.hashBits != 128 {
+			fmt.Fprintf(os.Stderr, "Error: --hash-bits must be 64 or 128.\n")
+			os.Exit(1)
+		}
+		if opts.maxMismatches < 0 {
+			fmt.Fprintf(os.Stderr, "Error: --max-mismatches can't be negative.\n")
+			os.Exit(1)
+		}
+		if opts.maxMismatches > 0 && opts.by == DedupByName {
+			fmt.Fprintf(os.Stderr, "Error: --max-mismatches only applies to --by seq and seq-rc.\n")
+			os.Exit(1)
+		}
+		if opts.maxMismatches > 0 && spillDir != "" {
+			fmt.Fprintf(os.Stderr, "Error: --max-mismatches can't be used with --spill-dir.\n")
+			os.Exit(1)
+		}
+		if spillDir != "" && spillParts < 1 {
+			fmt.Fprintf(os.Stderr, "Error: --spill-parts must be at least 1.\n")
+			os.Exit(1)
+		}
+
+		readers := openReaders(pairedInputFileNames(cmd, args))
+		defer closeReaders(readers)
+		paired := len(readers) == 2
+		writers := openPairedWriters(cmd, paired)
+		defer closeWriters(writers)
+		emit := func(set []*fastx.Record) {
+			writeRecSet(writers, set)
+		}
+
+		d := newDedupper(opts)
+		var in, unique int
+		if spillDir == "" {
+			for set := range pipeline.ChannelRecSets(readers...) {
+				d.add(set, emit)
+			}
+			d.flush(emit)
+			in, unique = d.in, d.unique
+		} else {
+			for _, fileName := range spillPartitions(readers, d, spillDir, spillParts) {
+				part := newDedupper(opts)
+				readSets(fileName, len(readers), func(set []*fastx.Record) { part.add(set, emit) })
+				part.flush(emit)
+				in += part.in
+				unique += part.unique
+				check(removeTemp(fileName))
+			}
+		}
+
+		dups := in - unique
+		unit := "Records"
+		if paired {
+			unit = "Pairs"
+		}
+		const sep string = "--------------------\n"
+		fmt.Fprintf(os.Stderr, "\nDEDUP SUMMARY\n"+sep)
+		fmt.Fprintf(os.Stderr, "%-21s %16d\n", unit+" in (#):", in)
+		fmt.Fprintf(os.Stderr, "%-21s %16d\n", "Unique (#):", unique)
+		fmt.Fprintf(os.Stderr, "%-21s %16d\n", "Duplicates (#):", dups)
+		fmt.Fprintf(os.Stderr, "%-21s %16.2f\n", "Duplication rate (%):", percent(dups, in))
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
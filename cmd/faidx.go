@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eernst/catseq/faidx"
+
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(faidxCmd)
+	addRegionFlags(faidxCmd)
+}
+
+var faidxCmd = &cobra.Command{
+	Use:   "faidx SEQUENCE_FILE [REGION...]",
+	Short: "Index a sequence file for random access.",
+	Long: `
+
+faidx builds the samtools-compatible .fai index of a FASTA or FASTQ file,
+replacing any existing one. For FASTA, each line of the index holds the
+sequence name, its length, the offset of its first base, and the number of
+bases and bytes per line; FASTQ indexes add the offset of the first quality.
+All lines of a sequence but the last must have the same length.
+
+Files compressed with bgzip (but not plain gzip) are supported, and get a .gzi
+index of their compressed blocks too. 2bit files are indexed already, and are
+left alone.
+
+Given regions, faidx instead extracts them as catseq subseq does, using the
+existing indexes unless they are missing or older than the file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		if len(args) < 1 {
+			fmt.Fprintf(os.Stderr, "Error: No sequence file given.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		regionsFileName, err := cmd.Flags().GetString("regions")
+		check(err)
+		if len(args) == 1 && regionsFileName == "" {
+			_, err := faidx.IndexFile(args[0])
+			check(err)
+		} else {
+			// Extracting regions uses the existing index, unless it is missing
+			// or stale.
+			r, err := faidx.Open(args[0])
+			check(err)
+			defer r.Close()
+			writer, err := xopen.Wopen("-") // "-" for STDOUT
+			check(err)
+			defer writer.Close()
+			writeRegions(writer, cmd, r, args[1:])
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -1,12 +1,17 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
+	"github.com/eernst/catseq/expr"
 	"github.com/eernst/catseq/pipeline"
+	"github.com/eernst/catseq/seqfile"
 	"github.com/eernst/catseq/seqmath"
 
 	"github.com/shenwei356/bio/seq"
@@ -17,9 +22,6 @@ import (
 	"github.com/spf13/pflag"
 )
 
-var minLength int
-var maxLength int
-
 func init() {
 	RootCmd.AddCommand(filterCmd)
 	filterCmd.Flags().IntP("length_min", "", -1, "Minimum sequence length to keep. [0]")
@@ -28,9 +30,98 @@ func init() {
 	filterCmd.Flags().Float64P("error_rate_avg_max", "", 1, "Keep reads with a mean error rate equal to or less than this. [1.00]")
 	filterCmd.Flags().Float64P("qual_avg_min", "", 0, "Keep reads with a mean phred base quality equal to or greater than this. [0.00]")
 	filterCmd.Flags().Float64P("qual_avg_max", "", -1, "Keep reads with a mean phred base quality equal to or greater than this. [∞]")
+	filterCmd.Flags().StringP("expr", "e", "", "Keep records for which this expression is true, e.g. 'len >= 1000 && meanq > 12'.")
+	filterCmd.Flags().StringP("report", "", "text", "Format of the filter statistics report. One of \"text\", \"json\", or \"none\".")
+	filterCmd.Flags().StringP("report-file", "", "", "Write the filter statistics report to this file. [STDERR]")
+	filterCmd.Flags().StringP("rejected", "", "", "Write rejected records to this file, with the failed criteria appended to the header.")
+
+	filterCmd.Long += "\n\nFILTER EXPRESSIONS\n\n" + expr.Usage(filterExprVars())
+}
+
+// filterVar binds an expression variable to the record metric it exposes.
+type filterVar struct {
+	expr.Var
+	num func(*InfoRecord) float64
+	str func(*InfoRecord) string
+}
+
+var filterVars = []filterVar{
+	{expr.Var{Name: "name", Type: expr.String, Help: "Full header line."}, nil,
+		func(r *InfoRecord) string { return string(r.Record.Name) }},
+	{expr.Var{Name: "id", Type: expr.String, Help: "Sequence ID (header up to the first space)."}, nil,
+		func(r *InfoRecord) string { return string(r.Record.ID) }},
+	{expr.Var{Name: "desc", Type: expr.String, Help: "Header description (after the ID)."}, nil,
+		func(r *InfoRecord) string { return string(r.Record.Desc) }},
+	{expr.Var{Name: "seq", Type: expr.String, Help: "Sequence."}, nil,
+		func(r *InfoRecord) string { return string(r.Record.Seq.Seq) }},
+	{expr.Var{Name: "len", Type: expr.Number, Help: "Sequence length."},
+		func(r *InfoRecord) float64 { return float64(r.Record.Seq.Length()) }, nil},
+	{expr.Var{Name: "gc", Type: expr.Number, Help: "GC ratio (0-1), ignoring ambiguous bases."},
+		func(r *InfoRecord) float64 { return r.GcRatio }, nil},
+	{expr.Var{Name: "gcbases", Type: expr.Number, Help: "Number of G, C and S bases."},
+		func(r *InfoRecord) float64 { return float64(r.GcBases) }, nil},
+	{expr.Var{Name: "atbases", Type: expr.Number, Help: "Number of A, T and W bases."},
+		func(r *InfoRecord) float64 { return float64(r.AtBases) }, nil},
+	{expr.Var{Name: "nbases", Type: expr.Number, Help: "Number of N bases."},
+		func(r *InfoRecord) float64 { return float64(r.NBases) }, nil},
+	{expr.Var{Name: "ambig", Type: expr.Number, Help: "Number of non-ACGTN bases."},
+		func(r *InfoRecord) float64 { return float64(r.NonATGCNBases) }, nil},
+	{expr.Var{Name: "lower", Type: expr.Number, Help: "Number of lower case (soft-masked) bases."},
+		func(r *InfoRecord) float64 { return float64(r.LcBases) }, nil},
+	{expr.Var{Name: "upper", Type: expr.Number, Help: "Number of upper case bases."},
+		func(r *InfoRecord) float64 { return float64(r.UcBases) }, nil},
+	{expr.Var{Name: "meanq", Type: expr.Number, Help: "Mean phred base quality (0 for FASTA)."},
+		func(r *InfoRecord) float64 { return r.MeanBaseQual }, nil},
+	{expr.Var{Name: "meanerr", Type: expr.Number, Help: "Mean base error probability (0 for FASTA)."},
+		func(r *InfoRecord) float64 { return r.MeanErrorProb }, nil},
+	{expr.Var{Name: "sumq", Type: expr.Number, Help: "Sum of phred base qualities."},
+		func(r *InfoRecord) float64 { return float64(r.SumQ) }, nil},
+	{expr.Var{Name: "sumerr", Type: expr.Number, Help: "Sum of base error probabilities (expected errors)."},
+		func(r *InfoRecord) float64 { return r.SumErrorProbs }, nil},
+}
+
+func filterExprVars() []expr.Var {
+	vars := make([]expr.Var, len(filterVars))
+	for i, v := range filterVars {
+		vars[i] = v.Var
+	}
+	return vars
+}
+
+// filterEnv evaluates filter expression variables against a single record.
+type filterEnv struct {
+	info *InfoRecord
+}
+
+func (e filterEnv) Number(i int) float64 {
+	return filterVars[i].num(e.info)
+}
+
+func (e filterEnv) String(i int) string {
+	return filterVars[i].str(e.info)
+}
+
+func (e filterEnv) Attr(key string) (string, bool) {
+	v, ok := pipeline.HeaderAttr(e.info.Record.Name, key)
+	return string(v), ok
+}
+
+// filterCriteria lists the filter criteria in the order they are checked,
+// named after the flags that enable them.
+var filterCriteria = []string{
+	"length_min",
+	"length_max",
+	"error_rate_avg_min",
+	"error_rate_avg_max",
+	"qual_avg_min",
+	"qual_avg_max",
+	"expr",
 }
 
-func passesFilters(s *seq.Seq, flags *pflag.FlagSet) bool {
+// failedFilters returns the criteria the record fails, in the order of
+// filterCriteria. A record passes when none are returned.
+func failedFilters(rec *fastx.Record, flags *pflag.FlagSet, program *expr.Program) (failed []string) {
+	s := rec.Seq
 	minLength, _ := flags.GetInt("length_min")
 	maxLength, _ := flags.GetInt("length_max")
 	minMeanError, _ := flags.GetFloat64("error_rate_avg_min")
@@ -38,13 +129,11 @@ func passesFilters(s *seq.Seq, flags *pflag.FlagSet) bool {
 	minMeanQ, _ := flags.GetFloat64("qual_avg_min")
 	maxMeanQ, _ := flags.GetFloat64("qual_avg_max")
 
-	// Validate argument values
-
-	switch {
-	case minLength >= 0 && s.Length() < minLength:
-		return false
-	case maxLength >= 0 && s.Length() > maxLength:
-		return false
+	if minLength >= 0 && s.Length() < minLength {
+		failed = append(failed, "length_min")
+	}
+	if maxLength >= 0 && s.Length() > maxLength {
+		failed = append(failed, "length_max")
 	}
 
 	if len(s.Qual) > 0 {
@@ -64,53 +153,172 @@ func passesFilters(s *seq.Seq, flags *pflag.FlagSet) bool {
 		meanQ := float64(qualScores) / float64(s.Length())
 		meanErrorProb := float64(errorProbs) / float64(s.Length())
 
-		switch {
-		case meanErrorProb < minMeanError:
-			return false
-		case meanErrorProb > maxMeanError:
-			return false
-		case minMeanQ >= 0 && meanQ < minMeanQ:
-			return false
-		case maxMeanQ >= 0 && meanQ > maxMeanQ:
-			return false
+		if meanErrorProb < minMeanError {
+			failed = append(failed, "error_rate_avg_min")
+		}
+		if meanErrorProb > maxMeanError {
+			failed = append(failed, "error_rate_avg_max")
+		}
+		if minMeanQ >= 0 && meanQ < minMeanQ {
+			failed = append(failed, "qual_avg_min")
 		}
+		if maxMeanQ >= 0 && meanQ > maxMeanQ {
+			failed = append(failed, "qual_avg_max")
+		}
+	}
+
+	if program != nil && !program.Eval(filterEnv{newInfoRecord(rec)}) {
+		failed = append(failed, "expr")
 	}
 
-	return true
+	return failed
+}
+
+// filterResult pairs a record with the criteria it failed.
+type filterResult struct {
+	Record *fastx.Record
+	Failed []string
 }
 
-func filterSeq(in <-chan *fastx.Record, flags *pflag.FlagSet) <-chan *fastx.Record {
-	out := make(chan *fastx.Record)
+func filterSeq(in <-chan *fastx.Record, flags *pflag.FlagSet, program *expr.Program) <-chan *filterResult {
+	out := make(chan *filterResult)
 	go func() {
 		for rec := range in {
-			if passesFilters(rec.Seq, flags) {
-				if DEBUG {
-					fmt.Fprintf(os.Stderr, "PASSED FILTER   Acc: %s		Length: %d\n", rec.Name, rec.Seq.Length())
-				}
-				out <- rec
+			failed := failedFilters(rec, flags, program)
+			if DEBUG && len(failed) == 0 {
+				fmt.Fprintf(os.Stderr, "PASSED FILTER   Acc: %s		Length: %d\n", rec.Name, rec.Seq.Length())
 			}
-			out <- nil
+			out <- &filterResult{Record: rec, Failed: failed}
 		}
 		close(out)
 	}()
 	return out
 }
 
+// filterTally counts records and bases.
+type filterTally struct {
+	Records int `json:"records"`
+	Bases   int `json:"bases"`
+}
+
+func (t *filterTally) add(rec *fastx.Record) {
+	t.Records++
+	t.Bases += rec.Seq.Length()
+}
+
+type criterionStats struct {
+	Criterion string `json:"criterion"`
+	// FirstFailed counts records for which this was the first failing criterion.
+	FirstFailed filterTally `json:"first_failed"`
+	// Failed counts every record failing this criterion.
+	Failed filterTally `json:"failed"`
+}
+
+type filterStats struct {
+	In       filterTally       `json:"in"`
+	Out      filterTally       `json:"out"`
+	Rejected filterTally       `json:"rejected"`
+	Criteria []*criterionStats `json:"criteria"`
+	index    map[string]*criterionStats
+}
+
+func newFilterStats() *filterStats {
+	stats := &filterStats{index: make(map[string]*criterionStats)}
+	for _, name := range filterCriteria {
+		c := &criterionStats{Criterion: name}
+		stats.Criteria = append(stats.Criteria, c)
+		stats.index[name] = c
+	}
+	return stats
+}
+
+func (stats *filterStats) add(res *filterResult) {
+	stats.In.add(res.Record)
+	if len(res.Failed) == 0 {
+		stats.Out.add(res.Record)
+		return
+	}
+	stats.Rejected.add(res.Record)
+	stats.index[res.Failed[0]].FirstFailed.add(res.Record)
+	for _, name := range res.Failed {
+		stats.index[name].Failed.add(res.Record)
+	}
+}
+
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
+
+func (stats *filterStats) writeText(w io.Writer) {
+	const sep string = "--------------------\n"
+	fmt.Fprintf(w, "\nFILTER SUMMARY\n"+sep)
+	fmt.Fprintf(w, "%-20s %12s %12s %8s\n", "", "records", "bases", "records%")
+	for _, row := range []struct {
+		label string
+		tally filterTally
+	}{{"Input", stats.In}, {"Kept", stats.Out}, {"Rejected", stats.Rejected}} {
+		fmt.Fprintf(w, "%-20s %12d %12d %8.2f\n", row.label, row.tally.Records, row.tally.Bases, percent(row.tally.Records, stats.In.Records))
+	}
+	fmt.Fprintf(w, "\nREJECTED BY\n"+sep)
+	fmt.Fprintf(w, "%-20s %12s %12s %12s %12s\n", "criterion", "first", "first bases", "any", "any bases")
+	for _, c := range stats.Criteria {
+		if c.Failed.Records == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%-20s %12d %12d %12d %12d\n", c.Criterion, c.FirstFailed.Records, c.FirstFailed.Bases, c.Failed.Records, c.Failed.Bases)
+	}
+}
+
 var filterCmd = &cobra.Command{
 	Use:   "filter SEQUENCE_FILE",
 	Short: "Filter sequences from (multi-)sequence files.",
 	Long: `
 	
-Filter input sequences by applying combinations of simple criteria.
+Filter input sequences by applying combinations of simple criteria, or an
+arbitrary expression given with --expr, e.g.:
+
+    catseq filter --expr 'len >= 1000 && meanq > 12 && gc < 0.6 || name =~ "chrM"'
+
+Expressions may use the per-sequence metrics reported by info and the header
+fields listed below. Header attributes of the form key=value are available
+through attr("key").
+
+` + seqFormatsHelp + `
 
-FASTQ and FASTA formats are currently supported and guessed based on file 
-extension. Seqeunce can be piped in on STDIN, in which case the format must be
-specified.`,
+Counts of records and bases kept and rejected, broken down by the first and by
+every failing criterion, are reported on STDERR (see --report).`,
 	Run: func(cmd *cobra.Command, args []string) {
 		StartProfiling()
 
 		flags := cmd.Flags()
 
+		var program *expr.Program
+		exprSrc, err := flags.GetString("expr")
+		check(err)
+		if exprSrc != "" {
+			program, err = expr.Compile(exprSrc, filterExprVars())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		reportFormat, err := flags.GetString("report")
+		check(err)
+		switch reportFormat {
+		case "text", "json", "none":
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Unknown report format %q.\n", reportFormat)
+			os.Exit(1)
+		}
+		reportFileName, err := flags.GetString("report-file")
+		check(err)
+		rejectedFileName, err := flags.GetString("rejected")
+		check(err)
+
 		// seqsFile is the multi-fast(a/q) over which we will iterate
 		var seqsInFileName string
 
@@ -126,22 +334,53 @@ specified.`,
 		}
 
 		seq.ValidateSeq = false
-		reader, err := fastx.NewDefaultReader(seqsInFileName)
+		reader, err := seqfile.NewReader(seqsInFileName, "")
 		check(err)
 
 		writer, err := xopen.Wopen("-") // "-" for STDOUT
 		check(err)
 		defer writer.Close()
 
+		var rejectedWriter *xopen.Writer
+		if rejectedFileName != "" {
+			rejectedWriter, err = xopen.Wopen(rejectedFileName)
+			check(err)
+			defer rejectedWriter.Close()
+		}
+
+		stats := newFilterStats()
+
 		// Using the pipeline pattern
 		inStream := pipeline.ChannelRec(reader)
-		processors := make([]<-chan *fastx.Record, runtime.GOMAXPROCS(0))
+		processors := make([]<-chan *filterResult, runtime.GOMAXPROCS(0))
 		for p := range processors {
-			processors[p] = filterSeq(inStream, flags)
+			processors[p] = filterSeq(inStream, flags, program)
 		}
-		for record := range pipeline.MergeRec(processors...) {
-			if record != nil {
-				record.FormatToWriter(writer, 0)
+		for res := range pipeline.Merge(processors...) {
+			stats.add(res)
+			if len(res.Failed) == 0 {
+				res.Record.FormatToWriter(writer, 0)
+			} else if rejectedWriter != nil {
+				rec := res.Record
+				rec.Name = append(rec.Name, []byte(" filter_failed="+strings.Join(res.Failed, ","))...)
+				rec.FormatToWriter(rejectedWriter, 0)
+			}
+		}
+
+		if reportFormat != "none" {
+			var reportOut io.Writer = os.Stderr
+			if reportFileName != "" {
+				reportWriter, err := xopen.Wopen(reportFileName)
+				check(err)
+				defer reportWriter.Close()
+				reportOut = reportWriter
+			}
+			if reportFormat == "json" {
+				enc := json.NewEncoder(reportOut)
+				enc.SetIndent("", "  ")
+				check(enc.Encode(stats))
+			} else {
+				stats.writeText(reportOut)
 			}
 		}
 
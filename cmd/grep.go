@@ -1,13 +1,20 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/eernst/catseq/pipeline"
+	"github.com/eernst/catseq/seqfile"
+	"github.com/eernst/catseq/seqmatch"
+	"github.com/eernst/catseq/seqmath"
 
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fastx"
@@ -20,8 +27,35 @@ const (
 	HeaderField string = "header"
 	SeqField           = "seq"
 	BothFields         = "both"
+	IDField            = "id"
+	DescField          = "desc"
+	QualField          = "qual"
 )
 
+// attrField returns the key of a "KEY=" field, which matches the value of a
+// key=value header attribute.
+func attrField(field string) (string, bool) {
+	if len(field) > 1 && strings.HasSuffix(field, "=") && !strings.ContainsAny(field, " \t|;") {
+		return field[:len(field)-1], true
+	}
+	return "", false
+}
+
+// validGrepField reports whether grep knows how to match field.
+func validGrepField(field string) bool {
+	switch field {
+	case HeaderField, SeqField, BothFields, IDField, DescField, QualField:
+		return true
+	}
+	_, ok := attrField(field)
+	return ok
+}
+
+// searchesSeq reports whether field includes the sequence.
+func searchesSeq(field string) bool {
+	return field == SeqField || field == BothFields
+}
+
 var grepField string
 var invert bool
 var ignoreCase bool
@@ -30,150 +64,745 @@ func init() {
 	RootCmd.AddCommand(grepCmd)
 	grepCmd.Flags().BoolP("fasta", "", false, "Input is in FASTA format.")
 	grepCmd.Flags().BoolP("fastq", "", false, "Input is in FASTQ format.")
-	grepCmd.Flags().StringP("field", "f", "header", "Which field to match the pattern against. One of \"header\",\"seq\", or \"both\".")
+	grepCmd.Flags().StringP("field", "f", "header", "Which field to match the pattern against. One of \"header\", \"seq\", \"both\", \"id\", \"desc\", \"qual\", or KEY= for the value of a key=value header attribute.")
 	grepCmd.Flags().BoolP("invert-match", "v", false, "Selected lines are those not matching any of the specified patterns.")
-	grepCmd.Flags().BoolP("ignore-case", "i", false, "Perform case insensitive matching.")
+	addMatchFlags(grepCmd)
+	grepCmd.Flags().BoolP("count", "c", false, "Only print the number of selected records.")
+	grepCmd.Flags().BoolP("list", "l", false, "Only print the IDs of selected records, one per line.")
+	grepCmd.Flags().IntP("max-count", "m", -1, "Stop reading after this many selected records. Negative for no limit.")
+	grepCmd.Flags().BoolP("only-matching", "o", false, "Output each sequence match as a record of its own, rather than the whole record.")
+	grepCmd.Flags().BoolP("locate", "", false, "Output the location of every sequence match instead of the matching records (see catseq locate).")
+	grepCmd.Flags().StringP("format", "", LocateBED, "Output format for --locate. One of \"bed\" or \"tsv\".")
+	grepCmd.Flags().StringP("color", "", ColorAuto, "Highlight matches in headers and sequences. One of \"auto\" (when writing to a terminal), \"always\", or \"never\".")
+	grepCmd.Flags().IntP("context", "C", -1, "Print only this many bases around each sequence match, rather than whole records. Negative to print whole records.")
+}
+
+// addMatchFlags adds the flags controlling how patterns are matched, shared
+// by grep and locate.
+func addMatchFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("ignore-case", "i", false, "Perform case insensitive matching.")
+	cmd.Flags().BoolP("iupac", "", false, "Treat the pattern as a motif of IUPAC ambiguity codes (the default for --field seq when it is one).")
+	cmd.Flags().BoolP("protein", "", false, "Interpret motif ambiguity codes as amino acids (B, Z, J, X) rather than nucleotides.")
+	cmd.Flags().BoolP("regex", "", false, "Always treat the pattern as a regular expression.")
+	cmd.Flags().StringP("strand", "", "+", "Which strand of the sequence to search. One of \"+\", \"-\", or \"both\".")
+	cmd.Flags().BoolP("both-strands", "", false, "Search both strands, i.e. also match the reverse complement of the pattern. Same as --strand both.")
+	cmd.Flags().IntP("max-mismatches", "", 0, "Allow up to this many mismatches when matching a motif.")
+	cmd.Flags().IntP("max-edits", "", 0, "Allow up to this many mismatches, insertions or deletions when matching a motif.")
+	cmd.Flags().StringP("patterns", "p", "", "Read patterns from this file, one per line, optionally preceded by a name and a tab.")
+	cmd.Flags().StringP("patterns-fasta", "", "", "Read patterns from this FASTA file, named by their IDs.")
+}
+
+// loadPatterns reads a pattern file with one pattern per line, or
+// "NAME<TAB>PATTERN". Blank lines and lines starting with '#' are skipped.
+func loadPatterns(fileName string) (names, patterns []string) {
+	reader, err := xopen.Ropen(fileName)
+	check(err)
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 1<<16), 1<<30)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, pattern := line, line
+		if i := strings.IndexByte(line, '\t'); i >= 0 {
+			name, pattern = line[:i], line[i+1:]
+		}
+		names = append(names, name)
+		patterns = append(patterns, pattern)
+	}
+	check(scanner.Err())
+	return names, patterns
+}
+
+// loadFastaPatterns reads patterns from the sequences of a FASTA file.
+func loadFastaPatterns(fileName string) (names, patterns []string) {
+	seq.ValidateSeq = false
+	reader, err := seqfile.NewReader(fileName, "")
+	check(err)
+	defer reader.Close()
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		names = append(names, string(rec.ID))
+		patterns = append(patterns, string(rec.Seq.Seq))
+	}
+	return names, patterns
+}
+
+// compileSeqMatcher returns the matcher for sequences: a motif or regex for
+// the plus strand, combined with one for the minus strand if requested.
+func compileSeqMatcher(pattern string, regex seqmatch.Matcher, motif bool, alphabet seqmatch.Alphabet, strands seqmatch.Strands,
+	errorModel seqmatch.ErrorModel, maxErrors int) (seqmatch.Matcher, error) {
+	var plus, minus seqmatch.Matcher
+	if motif {
+		var err error
+		if plus, err = seqmatch.CompileApprox(pattern, alphabet, errorModel, maxErrors); err != nil {
+			return nil, err
+		}
+		if strands&seqmatch.MinusStrand != 0 {
+			if minus, err = seqmatch.CompileApprox(seqmatch.ReverseComplementMotif(pattern), alphabet, errorModel, maxErrors); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		plus = regex
+		minus = seqmatch.ReverseComplementText{Matcher: plus}
+	}
+	switch strands {
+	case seqmatch.PlusStrand:
+		return plus, nil
+	case seqmatch.MinusStrand:
+		return &seqmatch.Stranded{Minus: minus}, nil
+	}
+	return &seqmatch.Stranded{Plus: plus, Minus: minus}, nil
+}
+
+// grepper selects records matching a pattern, or any of a set of patterns.
+type grepper struct {
+	field   string
+	invert  bool
+	header  seqmatch.Matcher
+	seq     seqmatch.Matcher
+	strands seqmatch.Strands
+	names   []string // pattern names, indexed by Match.Pattern
+	// patternSet annotates selected records with the patterns that matched.
+	patternSet bool
+	// locate collects the location of every sequence match, for --locate and
+	// --only-matching.
+	locate bool
+	// spans collects the matches in selected records, for --color and
+	// --context.
+	spans bool
 }
 
-func grepRecs(in <-chan *fastx.Record, regex *regexp.Regexp, grepField string) <-chan *fastx.Record {
-	out := make(chan *fastx.Record)
+// grepResult is a selected record, with its sequence matches when locating,
+// highlighting or printing context, and its header matches when highlighting.
+type grepResult struct {
+	Record        *fastx.Record
+	Matches       []seqmatch.Match
+	HeaderMatches []seqmatch.Match
+}
+
+// newGrepper compiles the patterns according to the matching flags of cmd.
+// With more than one pattern, or patterns from a file, they are matched as a
+// set.
+func newGrepper(cmd *cobra.Command, names, patterns []string, patternSet bool, field string, locate bool) *grepper {
+	flags := cmd.Flags()
+	var err error
+
+	ignoreCase, err = flags.GetBool("ignore-case")
+	check(err)
+
+	useIUPAC, err := flags.GetBool("iupac")
+	check(err)
+	useProtein, err := flags.GetBool("protein")
+	check(err)
+	forceRegex, err := flags.GetBool("regex")
+	check(err)
+	alphabet := seqmatch.Nucleotide
+	if useProtein {
+		alphabet = seqmatch.Protein
+		useIUPAC = true
+	}
+	if useIUPAC && forceRegex {
+		fmt.Fprintf(os.Stderr, "Error: --iupac and --regex are mutually exclusive.\n")
+		os.Exit(1)
+	}
+	if useIUPAC && !searchesSeq(field) {
+		fmt.Fprintf(os.Stderr, "Error: IUPAC motifs can only be matched against sequences.\n")
+		os.Exit(1)
+	}
+	if field == SeqField && !forceRegex && !useIUPAC {
+		useIUPAC = true
+		for _, pattern := range patterns {
+			if !seqmatch.IsMotif(pattern, alphabet) {
+				useIUPAC = false
+				break
+			}
+		}
+	}
+
+	maxMismatches, err := flags.GetInt("max-mismatches")
+	check(err)
+	maxEdits, err := flags.GetInt("max-edits")
+	check(err)
+	errorModel, maxErrors := seqmatch.Exact, 0
+	switch {
+	case maxMismatches < 0 || maxEdits < 0:
+		fmt.Fprintf(os.Stderr, "Error: The number of allowed differences can't be negative.\n")
+		os.Exit(1)
+	case maxMismatches > 0 && maxEdits > 0:
+		fmt.Fprintf(os.Stderr, "Error: --max-mismatches and --max-edits are mutually exclusive.\n")
+		os.Exit(1)
+	case maxMismatches > 0:
+		errorModel, maxErrors = seqmatch.Mismatches, maxMismatches
+	case maxEdits > 0:
+		errorModel, maxErrors = seqmatch.Edits, maxEdits
+	}
+	if errorModel != seqmatch.Exact && (!useIUPAC || field != SeqField) {
+		fmt.Fprintf(os.Stderr, "Error: Approximate matching needs --field seq and a motif of IUPAC codes.\n")
+		os.Exit(1)
+	}
+
+	strandFlag, err := flags.GetString("strand")
+	check(err)
+	bothStrands, err := flags.GetBool("both-strands")
+	check(err)
+	if bothStrands {
+		strandFlag = "both"
+	}
+	strands, err := seqmatch.ParseStrands(strandFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if strands != seqmatch.PlusStrand && (!searchesSeq(field) || useProtein) {
+		fmt.Fprintf(os.Stderr, "Error: Only nucleotide sequences can be searched on the minus strand.\n")
+		os.Exit(1)
+	}
+
+	regexFlags := ""
+	if ignoreCase {
+		// perhaps faster to just UC the string
+		// http://stackoverflow.com/questions/15326421/how-do-i-do-a-case-insensitive-regular-expression-in-go
+		regexFlags = "(?i)"
+	}
+	g := &grepper{field: field, invert: invert, strands: strands, names: names, patternSet: patternSet, locate: locate}
+
+	if patternSet {
+		regexSet, err := seqmatch.CompileRegexpSet(patterns, regexFlags)
+		if err != nil && useIUPAC {
+			// Motifs such as "*K" needn't be valid regular expressions;
+			// headers are then searched for them literally.
+			regexSet, err = seqmatch.CompileRegexpSet(quoteMetas(patterns), regexFlags)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid pattern: %v\n", err)
+			os.Exit(1)
+		}
+		g.header = regexSet
+		if useIUPAC {
+			g.seq, err = seqmatch.CompileMotifSet(patterns, alphabet, strands, errorModel, maxErrors)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Invalid motif: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			g.seq = regexSet
+			if strands != seqmatch.PlusStrand {
+				stranded := &seqmatch.Stranded{Minus: seqmatch.ReverseComplementText{Matcher: regexSet}}
+				if strands&seqmatch.PlusStrand != 0 {
+					stranded.Plus = regexSet
+				}
+				g.seq = stranded
+			}
+		}
+		return g
+	}
+
+	pattern := patterns[0]
+	regex, err := regexp.Compile(regexFlags + pattern)
+	if err != nil && useIUPAC {
+		regex, err = regexp.Compile(regexFlags + regexp.QuoteMeta(pattern))
+	}
+	check(err)
+	g.header = seqmatch.Regexp{Regexp: regex}
+	g.seq, err = compileSeqMatcher(pattern, seqmatch.Regexp{Regexp: regex, Overlapping: locate}, useIUPAC, alphabet, strands, errorModel, maxErrors)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid motif: %v\n", err)
+		os.Exit(1)
+	}
+	return g
+}
+
+// quoteMetas quotes the regular expression metacharacters of patterns.
+func quoteMetas(patterns []string) []string {
+	quoted := make([]string, len(patterns))
+	for i, p := range patterns {
+		quoted[i] = regexp.QuoteMeta(p)
+	}
+	return quoted
+}
+
+// matchSeq matches a record's sequence, noting in the header which strand
+// matched when searching the minus strand.
+func (g *grepper) matchSeq(rec *fastx.Record) bool {
+	stranded, ok := g.seq.(*seqmatch.Stranded)
+	if !ok {
+		return g.seq.Match(rec.Seq.Seq)
+	}
+	strands := stranded.MatchedStrands(rec.Seq.Seq)
+	if strands != 0 && !g.invert {
+		rec.Name = append(rec.Name, " strand="+strands.String()...)
+	}
+	return strands != 0
+}
+
+// text returns the text of a record's field other than the sequence, given
+// its header name, and the offset of the text within name (-1 for qualities).
+// It returns false if the record lacks the header attribute selected by a
+// KEY= field.
+func (g *grepper) text(rec *fastx.Record, name []byte) ([]byte, int, bool) {
+	switch g.field {
+	case HeaderField, BothFields:
+		return name, 0, true
+	case IDField:
+		return rec.ID, 0, true
+	case DescField:
+		if len(name) <= len(rec.ID) {
+			return nil, len(name), true
+		}
+		desc := bytes.TrimLeft(name[len(rec.ID):], " \t")
+		return desc, len(name) - len(desc), true
+	case QualField:
+		return rec.Seq.Qual, -1, true
+	}
+	key, _ := attrField(g.field)
+	value, ok := pipeline.HeaderAttr(name, key)
+	// value is a subslice of name.
+	return value, cap(name) - cap(value), ok
+}
+
+// grep returns the result for a selected record, or nil.
+func (g *grepper) grep(rec *fastx.Record) *grepResult {
+	if g.locate {
+		matches := g.seq.FindAll(nil, rec.Seq.Seq)
+		if len(matches) == 0 {
+			return nil
+		}
+		return &grepResult{Record: rec, Matches: matches}
+	}
+
+	// The header before any strand= or patterns= annotation.
+	name := rec.Name
+	var res *grepResult
+	if g.patternSet {
+		res = g.grepSet(rec)
+	} else {
+		res = g.grepOne(rec)
+	}
+	if res != nil && g.spans && !g.invert {
+		g.collectSpans(res, name)
+	}
+	return res
+}
+
+// collectSpans records where the patterns matched in a selected record, for
+// highlighting or printing context.
+func (g *grepper) collectSpans(res *grepResult, name []byte) {
+	rec := res.Record
+	if searchesSeq(g.field) {
+		res.Matches = g.seq.FindAll(nil, rec.Seq.Seq)
+	}
+	if g.field == SeqField {
+		return
+	}
+	text, offset, ok := g.text(rec, name)
+	if !ok || offset < 0 {
+		return
+	}
+	for _, m := range g.header.FindAll(nil, text) {
+		m.Start += offset
+		m.End += offset
+		res.HeaderMatches = append(res.HeaderMatches, m)
+	}
+}
+
+// grepOne matches a record against a single pattern.
+func (g *grepper) grepOne(rec *fastx.Record) *grepResult {
+	var matched bool
+	switch g.field {
+	case SeqField:
+		matched = g.matchSeq(rec)
+	case BothFields:
+		matched = g.header.Match(rec.Name) || g.matchSeq(rec)
+	default:
+		text, _, ok := g.text(rec, rec.Name)
+		matched = ok && g.header.Match(text)
+	}
+	if matched == g.invert {
+		return nil
+	}
+	return &grepResult{Record: rec}
+}
+
+// grepSet matches a record against a pattern set, appending the names of the
+// patterns that matched (and the strands, when searching the minus strand) to
+// the header of selected records.
+func (g *grepper) grepSet(rec *fastx.Record) *grepResult {
+	var matches []seqmatch.Match
+	if g.field != SeqField {
+		if text, _, ok := g.text(rec, rec.Name); ok {
+			matches = g.header.FindAll(matches, text)
+		}
+	}
+	nHeader := len(matches)
+	if searchesSeq(g.field) {
+		matches = g.seq.FindAll(matches, rec.Seq.Seq)
+	}
+	matched := len(matches) > 0
+	if matched == g.invert {
+		return nil
+	}
+	if !matched {
+		return &grepResult{Record: rec}
+	}
+
+	hit := make([]bool, len(g.names))
+	var strands seqmatch.Strands
+	for i, m := range matches {
+		hit[m.Pattern] = true
+		if i >= nHeader {
+			if m.Minus {
+				strands |= seqmatch.MinusStrand
+			} else {
+				strands |= seqmatch.PlusStrand
+			}
+		}
+	}
+	var hitNames []string
+	for i, h := range hit {
+		if h {
+			hitNames = append(hitNames, g.names[i])
+		}
+	}
+	rec.Name = append(rec.Name, " patterns="+strings.Join(hitNames, ",")...)
+	if g.strands != seqmatch.PlusStrand && strands != 0 {
+		rec.Name = append(rec.Name, " strand="+strands.String()...)
+	}
+	return &grepResult{Record: rec}
+}
+
+func grepRecs(in <-chan *fastx.Record, g *grepper) <-chan *grepResult {
+	out := make(chan *grepResult)
 	go func() {
 		for rec := range in {
 			if DEBUG {
-				fmt.Fprintf(os.Stderr, "Matching %v against field %v containing %v ... ", regex.String(), grepField, rec.Name)
+				fmt.Fprintf(os.Stderr, "Matching against field %v containing %v ... ", g.field, rec.Name)
 			}
 
-			switch grepField {
-			case HeaderField:
-				if regex.Match(rec.Name) != invert {
-					if DEBUG {
-						fmt.Fprintf(os.Stderr, "Matched!\n")
-					}
-					out <- rec
-				} else {
-					if DEBUG {
-						fmt.Fprintf(os.Stderr, "No match!\n")
-					}
-					out <- nil
-				}
-			case SeqField:
-				if regex.Match(rec.Seq.Seq) != invert {
-					if DEBUG {
-						fmt.Fprintf(os.Stderr, "Matched!\n")
-					}
-					out <- rec
-				} else {
-					if DEBUG {
-						fmt.Fprintf(os.Stderr, "No match!\n")
-					}
-					out <- nil
-				}
-			case BothFields:
-				if (regex.Match(rec.Name) || regex.Match(rec.Seq.Seq)) != invert {
-					if DEBUG {
-						fmt.Fprintf(os.Stderr, "Matched!\n")
-					}
-					out <- rec
+			res := g.grep(rec)
+			if DEBUG {
+				if res != nil {
+					fmt.Fprintf(os.Stderr, "Matched!\n")
 				} else {
-					if DEBUG {
-						fmt.Fprintf(os.Stderr, "No match!\n")
-					}
-					out <- nil
+					fmt.Fprintf(os.Stderr, "No match!\n")
 				}
-			default:
-				fmt.Fprintf(os.Stderr, "Error: Unknown grep field.")
-				os.Exit(1)
 			}
-
+			out <- res
 		}
 		close(out)
 	}()
 	return out
 }
 
-var grepCmd = &cobra.Command{
-	Use:   "grep PATTERN [SEQUENCE_FILE]",
-	Short: "Match a regular expression in sequences from (multi-)sequence files.",
-	Long: `
-	
-grep scans through input sequences and outputs only those that match the 
-provided pattern. By default, all data is considered for a match, but the
-search can be limited to the header, sequence, quality, or quality header.
-
-The pattern language is the same as the regular expression syntax used by Perl,
-Python, etc. Reference: https://golang.org/s/re2syntax
-
-FASTQ and FASTA formats are currently supported and guessed based on file 
-extension. Seqeunce can be piped in on STDIN, in which case the format must be
-specified.
-`,
-	Run: func(cmd *cobra.Command, args []string) {
-		StartProfiling()
-
-		flags := cmd.Flags()
+// writeMatchedParts writes each sequence match of a record as a record named
+// after its 1-based coordinates, e.g. "seq1:11-30". Minus strand matches are
+// reverse complemented so they read in the direction of the pattern.
+func writeMatchedParts(writer *xopen.Writer, res *grepResult, names []string, patternSet bool) {
+	rec := res.Record
+	for _, m := range res.Matches {
+		s := append([]byte(nil), rec.Seq.Seq[m.Start:m.End]...)
+		var q []byte
+		if len(rec.Seq.Qual) > 0 {
+			q = append([]byte(nil), rec.Seq.Qual[m.Start:m.End]...)
+		}
+		if m.Minus {
+			s = seqmath.ReverseComplement(s, seqmath.IsRNA(s))
+			seqmath.Reverse(q)
+		}
+		id := fmt.Sprintf("%s:%d-%d", rec.ID, m.Start+1, m.End)
+		name := id
+		if m.Minus {
+			name += " strand=-"
+		}
+		if patternSet {
+			name += " pattern=" + names[m.Pattern]
+		}
+		var part *fastx.Record
 		var err error
+		if q != nil {
+			part, err = fastx.NewRecordWithQualWithoutValidation(rec.Seq.Alphabet, []byte(id), []byte(name), nil, s, q)
+		} else {
+			part, err = fastx.NewRecordWithoutValidation(rec.Seq.Alphabet, []byte(id), []byte(name), nil, s)
+		}
+		check(err)
+		part.FormatToWriter(writer, 0)
+	}
+}
+
+// runGrep implements grep and, with locate set, the locate command.
+func runGrep(cmd *cobra.Command, args []string, locate bool) {
+	flags := cmd.Flags()
+	var err error
 
+	var countOnly, listIDs, onlyMatching, color bool
+	maxCount, context := -1, -1
+	if !locate {
 		invert, err = flags.GetBool("invert-match")
 		check(err)
-		ignoreCase, err = flags.GetBool("ignore-case")
+		locate, err = flags.GetBool("locate")
 		check(err)
+		countOnly, err = flags.GetBool("count")
+		check(err)
+		listIDs, err = flags.GetBool("list")
+		check(err)
+		maxCount, err = flags.GetInt("max-count")
+		check(err)
+		onlyMatching, err = flags.GetBool("only-matching")
+		check(err)
+		colorMode, err := flags.GetString("color")
+		check(err)
+		color, err = useColor(colorMode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		context, err = flags.GetInt("context")
+		check(err)
+	}
+	modes := 0
+	for _, set := range []bool{locate, countOnly, listIDs, onlyMatching, context >= 0} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		fmt.Fprintf(os.Stderr, "Error: --count, --list, --only-matching, --context and --locate are mutually exclusive.\n")
+		os.Exit(1)
+	}
 
-		// seqsFile is the multi-fast(a/q) over which we will iterate
-		var seqsInFileName string
+	// seqsFile is the multi-fast(a/q) over which we will iterate
+	var seqsInFileName string
 
-		var pattern string
-		switch {
-		case len(args) == 0:
-			fmt.Fprintf(os.Stderr, "Error: Can't grep without a pattern.\n")
-			cmd.Usage()
+	patternsFileName, err := flags.GetString("patterns")
+	check(err)
+	patternsFastaFileName, err := flags.GetString("patterns-fasta")
+	check(err)
+	var names, patterns []string
+	switch {
+	case patternsFileName != "" && patternsFastaFileName != "":
+		fmt.Fprintf(os.Stderr, "Error: --patterns and --patterns-fasta are mutually exclusive.\n")
+		os.Exit(1)
+	case patternsFileName != "":
+		names, patterns = loadPatterns(patternsFileName)
+	case patternsFastaFileName != "":
+		names, patterns = loadFastaPatterns(patternsFastaFileName)
+	}
+	patternSet := patterns != nil
+	if patternSet {
+		if len(patterns) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: No patterns found.\n")
 			os.Exit(1)
-		case len(args) == 1:
-			pattern = args[0]
-			// TODO: Check here for valid sequence on stdin
-			seqsInFileName = "-"
-			fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
-		case len(args) == 2:
-			pattern = args[0]
-			seqsInFileName = args[1]
-		default:
-			fmt.Fprintf(os.Stderr, "Error: Wrong number of positional arguments given.\n")
-			cmd.Usage()
+		}
+		// No PATTERN argument when patterns come from a file.
+		args = append([]string{""}, args...)
+	}
+
+	switch {
+	case len(args) == 0:
+		fmt.Fprintf(os.Stderr, "Error: Can't grep without a pattern.\n")
+		cmd.Usage()
+		os.Exit(1)
+	case len(args) == 1:
+		// TODO: Check here for valid sequence on stdin
+		seqsInFileName = "-"
+		fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
+	case len(args) == 2:
+		seqsInFileName = args[1]
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Wrong number of positional arguments given.\n")
+		cmd.Usage()
+		os.Exit(1)
+	}
+	if DEBUG && len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "grep called with args[]:\n %v\n", args)
+	}
+
+	grepField = SeqField
+	if flags.Lookup("field") != nil && (!locate || flags.Changed("field")) {
+		grepField, err = flags.GetString("field")
+		check(err)
+	}
+	if !validGrepField(grepField) {
+		fmt.Fprintf(os.Stderr, "Error: Unknown grep field %q. Use one of header, seq, both, id, desc, qual, or KEY= for a header attribute.\n", grepField)
+		os.Exit(1)
+	}
+
+	if context >= 0 {
+		if !searchesSeq(grepField) {
+			fmt.Fprintf(os.Stderr, "Error: --context needs --field seq or both.\n")
 			os.Exit(1)
 		}
-		if DEBUG && len(args) > 0 {
-			fmt.Fprintf(os.Stderr, "grep called with args[]:\n %v\n", args)
+		if invert {
+			fmt.Fprintf(os.Stderr, "Error: --invert-match can't be combined with --context.\n")
+			os.Exit(1)
+		}
+	}
+	if onlyMatching {
+		if grepField != SeqField {
+			fmt.Fprintf(os.Stderr, "Error: --only-matching needs --field seq.\n")
+			os.Exit(1)
 		}
+		if invert {
+			fmt.Fprintf(os.Stderr, "Error: --invert-match can't be combined with --only-matching.\n")
+			os.Exit(1)
+		}
+	}
 
-		if ignoreCase {
-			// perhaps faster to just UC the string
-			// http://stackoverflow.com/questions/15326421/how-do-i-do-a-case-insensitive-regular-expression-in-go
-			pattern = "(?i)" + pattern
+	var locateFormat string
+	if locate {
+		if grepField != SeqField {
+			fmt.Fprintf(os.Stderr, "Error: Match locations can only be reported for --field seq.\n")
+			os.Exit(1)
 		}
-		regex, err := regexp.Compile(pattern)
+		if invert {
+			fmt.Fprintf(os.Stderr, "Error: --invert-match can't be combined with --locate.\n")
+			os.Exit(1)
+		}
+		locateFormat, err = flags.GetString("format")
 		check(err)
+		if locateFormat != LocateBED && locateFormat != LocateTSV {
+			fmt.Fprintf(os.Stderr, "Error: Unknown locate format %q.\n", locateFormat)
+			os.Exit(1)
+		}
+	}
 
-		seq.ValidateSeq = false
-		reader, err := fastx.NewDefaultReader(seqsInFileName)
-		check(err)
+	if !patternSet {
+		names, patterns = []string{args[0]}, []string{args[0]}
+	}
+	g := newGrepper(cmd, names, patterns, patternSet, grepField, locate || onlyMatching)
+	g.spans = context >= 0 || (color && !countOnly && !listIDs && !locate && !onlyMatching)
 
-		writer, err := xopen.Wopen("-") // "-" for STDOUT
-		check(err)
-		defer writer.Close()
+	seq.ValidateSeq = false
+	reader, err := seqfile.NewReader(seqsInFileName, "")
+	check(err)
 
-		grepField, err = flags.GetString("field")
-		check(err)
+	writer, err := xopen.Wopen("-") // "-" for STDOUT
+	check(err)
+	defer writer.Close()
 
-		// Using the pipeline pattern
+	if locate && PrintHeader {
+		writeLocateHeader(writer, locateFormat)
+	}
+
+	var selected int
+	if maxCount != 0 {
+		// Using the pipeline pattern. With --max-count a single processor keeps
+		// the records in input order, so the first ones selected are output.
 		inStream := pipeline.ChannelRec(reader)
-		processors := make([]<-chan *fastx.Record, runtime.GOMAXPROCS(0))
+		nProcs := runtime.GOMAXPROCS(0)
+		if maxCount > 0 {
+			nProcs = 1
+		}
+		processors := make([]<-chan *grepResult, nProcs)
 		for p := range processors {
-			processors[p] = grepRecs(inStream, regex, grepField)
+			processors[p] = grepRecs(inStream, g)
 		}
-		for record := range pipeline.MergeRec(processors...) {
-			if record != nil {
-				record.FormatToWriter(writer, 0)
+		for res := range pipeline.Merge(processors...) {
+			if res == nil {
+				continue
+			}
+			selected++
+			switch {
+			case countOnly:
+			case listIDs:
+				fmt.Fprintf(writer, "%s\n", res.Record.ID)
+			case locate:
+				writeLocations(writer, locateFormat, res, g.names)
+			case onlyMatching:
+				writeMatchedParts(writer, res, g.names, g.patternSet)
+			case context >= 0:
+				writeContexts(writer, res, context, color)
+			case color:
+				writeHighlighted(writer, res.Record, res.HeaderMatches, res.Matches, LineWrap)
+			default:
+				res.Record.FormatToWriter(writer, LineWrap)
+			}
+			if selected == maxCount {
+				// Stop reading; the remaining input is left unread.
+				break
 			}
 		}
+	}
+	if countOnly {
+		fmt.Fprintf(writer, "%d\n", selected)
+	}
+}
+
+var grepCmd = &cobra.Command{
+	Use:   "grep [PATTERN | -p PATTERN_FILE] [SEQUENCE_FILE]",
+	Short: "Match a regular expression in sequences from (multi-)sequence files.",
+	Long: `
+
+grep scans through input sequences and outputs only those that match the
+provided pattern. By default the pattern is matched against the header; with
+--field it can instead be matched against:
+
+  seq     the sequence
+  both    the header or the sequence
+  id      the ID, i.e. the header up to the first whitespace
+  desc    the description following the ID
+  qual    the quality string of FASTQ records
+  KEY=    the value of a key=value attribute in the header, e.g. acc= for
+          ">AB000263 |acc=AB000263|len=368"; records without it never match
+
+The pattern language is the same as the regular expression syntax used by Perl,
+Python, etc. Reference: https://golang.org/s/re2syntax
+
+Sequences can also be searched for motifs written with IUPAC ambiguity codes,
+such as the primer GTGYCAGCMGCCGCGGTAA, where Y stands for C or T and M for A
+or C. With --field seq, a pattern made only of IUPAC nucleotide codes is
+searched as a motif unless --regex is given; --iupac forces motif matching and
+--protein selects the amino acid codes B (D/N), Z (E/Q), J (I/L) and X (any).
+Motifs always match case-insensitively, so soft-masked bases are found too,
+and are searched with a bit-parallel matcher rather than a regular expression.
+
+By default only the given (plus) strand of each sequence is searched. With
+--both-strands or --strand -, the reverse complement of the pattern (with
+ambiguity codes complemented, e.g. R to Y) is also or instead searched, and the
+strand(s) that matched are appended to the header, e.g. "strand=-".
+
+Motifs can be matched approximately to tolerate sequencing errors, allowing
+either up to --max-mismatches substitutions (Hamming distance) or up to
+--max-edits substitutions, insertions and deletions (Levenshtein distance,
+computed with Myers' bit-parallel algorithm).
+
+Many patterns, such as thousands of barcodes, can be searched for at once by
+reading them from a file with --patterns (one per line, or NAME<TAB>PATTERN)
+or --patterns-fasta, in which case no PATTERN argument is given. Exact motifs
+are then combined into an Aho-Corasick automaton and regular expressions into
+a single alternation, so each record is scanned once. The names of the
+patterns that matched are appended to the header, e.g. "patterns=bc01,bc07".
+
+As with GNU grep, --count prints only the number of selected records, --list
+only their IDs, and --max-count stops reading the input once that many records
+have been selected (in input order). --only-matching outputs every sequence
+match as a record of its own, named after its 1-based coordinates in the
+source record (e.g. "seq1:11-30"), with its qualities for FASTQ input; minus
+strand matches are reverse complemented. --invert-match applies to --count,
+--list and --max-count as well.
+
+With --color, the matched parts of headers and sequences are highlighted in
+the output, which respects --wrap. By default this happens only when writing
+to a terminal. --context N prints, instead of whole records, a window of N
+bases on either side of each sequence match, named after its 1-based
+coordinates; overlapping windows are merged.
+
+With --locate, the coordinates of every sequence match are written instead of
+the matching records, as for catseq locate.
+
+` + seqFormatsHelp + `
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		runGrep(cmd, args, false)
 
 		time.Sleep(0 * time.Millisecond)
 
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(headCmd)
+	headCmd.Flags().IntP("lines", "n", 10, "Number of records to output.")
+}
+
+var headCmd = &cobra.Command{
+	Use:   "head [SEQUENCE_FILE]",
+	Short: "Output the first records of (multi-)sequence files.",
+	Long: `
+
+head outputs the first N records (not lines), for both FASTA and FASTQ, and
+stops reading the input as soon as they have been written.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		n, err := cmd.Flags().GetInt("lines")
+		check(err)
+		if n > 0 {
+			runSlice(cmd, args, 1, n)
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/eernst/catseq/seqmatch"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+const (
+	// Values of --color
+	ColorAuto   string = "auto"
+	ColorAlways        = "always"
+	ColorNever         = "never"
+)
+
+// ANSI escape sequences starting and ending a highlighted match, bold red as
+// in GNU grep.
+var (
+	colorStart = []byte("\x1b[01;31m")
+	colorEnd   = []byte("\x1b[m")
+)
+
+// useColor decides whether to highlight matches, given the --color mode.
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case ColorAlways:
+		return true, nil
+	case ColorNever:
+		return false, nil
+	case ColorAuto:
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("unknown color mode %q", mode)
+}
+
+// writeSpans writes text wrapped at width, highlighting the bytes covered by
+// spans. Highlighting is closed at the end of each line so that every line
+// can be displayed on its own.
+func writeSpans(w io.Writer, text []byte, spans []seqmatch.Match, width int) {
+	var marked []bool
+	if len(spans) > 0 {
+		marked = make([]bool, len(text))
+		for _, m := range spans {
+			for i := max(m.Start, 0); i < min(m.End, len(text)); i++ {
+				marked[i] = true
+			}
+		}
+	}
+	if width < 1 {
+		width = len(text)
+	}
+	for line := 0; line < len(text); line += width {
+		if line > 0 {
+			w.Write(_newline)
+		}
+		end := min(line+width, len(text))
+		if marked == nil {
+			w.Write(text[line:end])
+			continue
+		}
+		for i := line; i < end; {
+			j := i + 1
+			for j < end && marked[j] == marked[i] {
+				j++
+			}
+			if marked[i] {
+				w.Write(colorStart)
+				w.Write(text[i:j])
+				w.Write(colorEnd)
+			} else {
+				w.Write(text[i:j])
+			}
+			i = j
+		}
+	}
+}
+
+var _newline = []byte{'\n'}
+
+// writeHighlighted writes a record with its header and sequence matches
+// highlighted. As with FormatToWriter, only FASTA sequences are wrapped.
+func writeHighlighted(w io.Writer, rec *fastx.Record, nameSpans, seqSpans []seqmatch.Match, width int) {
+	fastq := len(rec.Seq.Qual) > 0
+	if fastq {
+		w.Write([]byte{'@'})
+		width = 0
+	} else {
+		w.Write([]byte{'>'})
+	}
+	writeSpans(w, rec.Name, nameSpans, 0)
+	w.Write(_newline)
+	writeSpans(w, rec.Seq.Seq, seqSpans, width)
+	w.Write(_newline)
+	if fastq {
+		w.Write([]byte("+\n"))
+		w.Write(rec.Seq.Qual)
+		w.Write(_newline)
+	}
+}
+
+// writeContexts writes a record for each window of n bases around the
+// sequence matches of res, merging overlapping windows. Windows are named
+// after their 1-based coordinates, e.g. "seq1:101-160". Empty matches, as
+// of the regex "A*", have no bases to show and are skipped.
+func writeContexts(w io.Writer, res *grepResult, n int, color bool) {
+	rec := res.Record
+	var matches []seqmatch.Match
+	for _, m := range sortMatches(res.Matches) {
+		if m.End > m.Start {
+			matches = append(matches, m)
+		}
+	}
+	for i := 0; i < len(matches); {
+		start := max(matches[i].Start-n, 0)
+		end := min(matches[i].End+n, len(rec.Seq.Seq))
+		j := i + 1
+		for j < len(matches) && matches[j].Start-n <= end {
+			end = max(end, min(matches[j].End+n, len(rec.Seq.Seq)))
+			j++
+		}
+		if end < start+1 {
+			i = j
+			continue
+		}
+
+		id := []byte(fmt.Sprintf("%s:%d-%d", rec.ID, start+1, end))
+		window := &fastx.Record{ID: id, Name: id, Seq: rec.Seq.SubSeq(start+1, end)}
+		var spans []seqmatch.Match
+		if color {
+			for _, m := range matches[i:j] {
+				m.Start -= start
+				m.End -= start
+				spans = append(spans, m)
+			}
+		}
+		writeHighlighted(w, window, nil, spans, LineWrap)
+		i = j
+	}
+}
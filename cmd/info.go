@@ -9,7 +9,8 @@ import (
 	"time"
 	"unicode"
 
-	//"github.com/eernst/catseq/pipeline"
+	"github.com/eernst/catseq/pipeline"
+	"github.com/eernst/catseq/seqfile"
 	"github.com/eernst/catseq/seqmath"
 
 	"github.com/shenwei356/bio/seq"
@@ -40,86 +41,88 @@ func init() {
 	infoCmd.Flags().BoolP("summary", "s", false, "Only output summary info for all sequences.")
 }
 
-func infoSeq(in <-chan fastx.RecordChunk) <-chan *InfoRecord {
-	out := make(chan *InfoRecord)
-	go func() {
-		for chunk := range in {
-			for _, rec := range chunk.Data {
-				s := rec.Seq
-				length := s.Length()
+// newInfoRecord computes the per-sequence metrics reported by info and
+// exposed to the other commands (e.g. filter expressions).
+func newInfoRecord(rec *fastx.Record) *InfoRecord {
+	s := rec.Seq
+	length := s.Length()
 
-				var ucBases int = 0
-				var lcBases int = 0
-				var gcBases int = 0
-				var atBases int = 0
-				var nonATGCNBases int = 0
-				var nBases int = 0
+	var ucBases int = 0
+	var lcBases int = 0
+	var gcBases int = 0
+	var atBases int = 0
+	var nonATGCNBases int = 0
+	var nBases int = 0
 
-				for _, char := range s.Seq {
+	for _, char := range s.Seq {
 
-					if unicode.IsLower(rune(char)) {
-						lcBases++
-					} else {
-						ucBases++
-					}
+		if unicode.IsLower(rune(char)) {
+			lcBases++
+		} else {
+			ucBases++
+		}
 
-					switch char {
-					case 'G', 'g', 'C', 'c':
-						gcBases++
-					case 'A', 'a', 'T', 't':
-						atBases++
-					case 'N', 'n':
-						nBases++
-					case 'S', 's':
-						gcBases++
-						nonATGCNBases++
-					case 'W', 'w':
-						atBases++
-						nonATGCNBases++
-					default:
-						nonATGCNBases++
-					}
-				}
+		switch char {
+		case 'G', 'g', 'C', 'c':
+			gcBases++
+		case 'A', 'a', 'T', 't':
+			atBases++
+		case 'N', 'n':
+			nBases++
+		case 'S', 's':
+			gcBases++
+			nonATGCNBases++
+		case 'W', 'w':
+			atBases++
+			nonATGCNBases++
+		default:
+			nonATGCNBases++
+		}
+	}
 
-				gcRatio := float64(gcBases) / float64(length-(nonATGCNBases+nBases))
+	gcRatio := float64(gcBases) / float64(length-(nonATGCNBases+nBases))
 
-				var qualScores int = 0
-				var errorProbs float64 = 0
-				var meanBaseQual float64
-				var meanErrorProb float64
+	var qualScores int = 0
+	var errorProbs float64 = 0
+	var meanBaseQual float64
+	var meanErrorProb float64
 
-				if len(s.Qual) > 0 {
-					if len(s.QualValue) <= 0 {
-						vals, err := seq.QualityValue(seq.Sanger, s.Qual)
-						s.QualValue = vals
-						check(err)
-					}
+	if len(s.Qual) > 0 {
+		if len(s.QualValue) <= 0 {
+			vals, err := seq.QualityValue(seq.Sanger, s.Qual)
+			s.QualValue = vals
+			check(err)
+		}
 
-					for _, score := range s.QualValue {
-						qualScores += score
-						errorProbs += seqmath.ErrorProbForQ(score)
-					}
+		for _, score := range s.QualValue {
+			qualScores += score
+			errorProbs += seqmath.ErrorProbForQ(score)
+		}
 
-					meanBaseQual = float64(qualScores) / float64(length)
-					meanErrorProb = float64(errorProbs) / float64(length)
-				}
+		meanBaseQual = float64(qualScores) / float64(length)
+		meanErrorProb = float64(errorProbs) / float64(length)
+	}
 
-				infoRec := &InfoRecord{
-					Record:        rec,
-					UcBases:       ucBases,
-					LcBases:       lcBases,
-					GcBases:       gcBases,
-					AtBases:       atBases,
-					NonATGCNBases: nonATGCNBases,
-					NBases:        nBases,
-					GcRatio:       gcRatio,
-					MeanBaseQual:  meanBaseQual,
-					MeanErrorProb: meanErrorProb,
-					SumQ:          qualScores,
-					SumErrorProbs: errorProbs}
-
-				out <- infoRec
-			}
+	return &InfoRecord{
+		Record:        rec,
+		UcBases:       ucBases,
+		LcBases:       lcBases,
+		GcBases:       gcBases,
+		AtBases:       atBases,
+		NonATGCNBases: nonATGCNBases,
+		NBases:        nBases,
+		GcRatio:       gcRatio,
+		MeanBaseQual:  meanBaseQual,
+		MeanErrorProb: meanErrorProb,
+		SumQ:          qualScores,
+		SumErrorProbs: errorProbs}
+}
+
+func infoSeq(in <-chan *fastx.Record) <-chan *InfoRecord {
+	out := make(chan *InfoRecord)
+	go func() {
+		for rec := range in {
+			out <- newInfoRecord(rec)
 		}
 		close(out)
 	}()
@@ -154,9 +157,7 @@ var infoCmd = &cobra.Command{
 Print basic sequence info including name, length, GC content, average quality,
 etc. in a tabular format, one input sequence per row.
 
-FASTQ and FASTA formats are currently supported and guessed based on file 
-extension. Seqeunce can be piped in on STDIN, in which case the format must be
-specified.`,
+` + seqFormatsHelp,
 	Run: func(cmd *cobra.Command, args []string) {
 		StartProfiling()
 
@@ -183,17 +184,17 @@ specified.`,
 		}
 
 		seq.ValidateSeq = false
-		reader, err := fastx.NewDefaultReader(seqsInFileName)
+		reader, err := seqfile.NewReader(seqsInFileName, "")
 		check(err)
 
 		if PrintHeader {
 			fmt.Fprintf(os.Stdout, "accession\tlength\tgc-content\tmean quality\tmean P(error)\t\n")
 		}
 
-		chunkStream := reader.ChunkChan(runtime.GOMAXPROCS(0), 1<<8)
+		inStream := pipeline.ChannelRec(reader)
 		processors := make([]<-chan *InfoRecord, runtime.GOMAXPROCS(0))
 		for p := range processors {
-			processors[p] = infoSeq(chunkStream)
+			processors[p] = infoSeq(inStream)
 		}
 
 		var totalSeqs int
@@ -207,6 +208,7 @@ specified.`,
 		var sumBaseErrorProbs float64
 		var sumMeanErrorProbs float64
 		var seqLens []int
+		var hasQual bool
 
 		for infoRec := range mergeInfoRec(processors...) {
 			if infoRec != nil {
@@ -219,7 +221,7 @@ specified.`,
 				if !summaryOnly {
 					fmt.Fprintf(os.Stdout, "%s\t%d\t%.2f", rec.Name, length, infoRec.GcRatio*100)
 
-					if reader.IsFastq {
+					if len(s.Qual) > 0 {
 						fmt.Fprintf(os.Stdout, "\t%.2f\t%.4f", infoRec.MeanBaseQual, infoRec.MeanErrorProb)
 					}
 
@@ -227,6 +229,7 @@ specified.`,
 				}
 
 				totalSeqs++
+				hasQual = hasQual || len(s.Qual) > 0
 				totalGcCount += infoRec.GcBases
 				totalSeqLength += length
 				totalNonATGCNBases += infoRec.NonATGCNBases
@@ -274,8 +277,7 @@ specified.`,
 		for xx := 10; xx <= 90; xx += 10 {
 			fmt.Fprintf(summaryOut, "N%02d (bp): %29d\n", xx, nxx[xx])
 		}
-		// Would be better to test the Sequence for quality info
-		if reader.IsFastq {
+		if hasQual {
 			fmt.Fprintf(summaryOut, "\nPER-SEQ\n"+sep)
 			fmt.Fprintf(summaryOut, "Mean Phred quality score: %13.2f\n", meanQualityPerSeq)
 			fmt.Fprintf(summaryOut, "Mean error rate: %22.4f\n", meanErrorProbPerSeq)
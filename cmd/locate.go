@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/eernst/catseq/seqmatch"
+	"github.com/eernst/catseq/seqmath"
+
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Output formats of match locations
+	LocateBED string = "bed"
+	LocateTSV        = "tsv"
+)
+
+func init() {
+	RootCmd.AddCommand(locateCmd)
+	addMatchFlags(locateCmd)
+	locateCmd.Flags().StringP("format", "", LocateBED, "Output format. One of \"bed\" or \"tsv\".")
+}
+
+func writeLocateHeader(writer *xopen.Writer, format string) {
+	if format == LocateBED {
+		fmt.Fprintf(writer, "#chrom\tstart\tend\tname\tscore\tstrand\n")
+	} else {
+		fmt.Fprintf(writer, "seqname\tstart\tend\tstrand\tpattern\tmatched\tmismatches\n")
+	}
+}
+
+// sortMatches sorts matches in place by position, and returns them.
+func sortMatches(matches []seqmatch.Match) []seqmatch.Match {
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Start != matches[j].Start {
+			return matches[i].Start < matches[j].Start
+		}
+		return matches[i].End < matches[j].End
+	})
+	return matches
+}
+
+// writeLocations writes one line per match of a record, in order of position.
+func writeLocations(writer *xopen.Writer, format string, res *grepResult, names []string) {
+	rec := res.Record
+	matches := sortMatches(res.Matches)
+	rna := format != LocateBED && seqmath.IsRNA(rec.Seq.Seq)
+	for _, m := range matches {
+		pattern := names[m.Pattern]
+		if format == LocateBED {
+			fmt.Fprintf(writer, "%s\t%d\t%d\t%s\t%d\t%c\n", rec.ID, m.Start, m.End, pattern, m.Edits, m.Strand())
+			continue
+		}
+		matched := rec.Seq.Seq[m.Start:m.End]
+		if m.Minus {
+			matched = seqmath.ReverseComplement(matched, rna)
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%c\t%s\t%s\t%d\n", rec.ID, m.Start+1, m.End, m.Strand(), pattern, matched, m.Edits)
+	}
+}
+
+var locateCmd = &cobra.Command{
+	Use:   "locate [PATTERN | -p PATTERN_FILE] [SEQUENCE_FILE]",
+	Short: "Report the coordinates of pattern matches in sequences.",
+	Long: `
+
+locate finds every match of a pattern in the input sequences, including
+overlapping matches, and writes one line per match. Patterns are matched
+exactly as with catseq grep --field seq: regular expressions, IUPAC motifs,
+either strand, approximate matching and pattern files (--patterns,
+--patterns-fasta) are all supported. The pattern column holds the pattern name
+when patterns are read from a file.
+
+Two output formats are available:
+
+  bed   BED6: seqname, 0-based start, end, pattern, mismatches/edits, strand
+  tsv   seqname, 1-based start, end, strand, pattern, matched text, mismatches
+
+In TSV output, minus strand matches are reverse complemented so the matched
+text reads in the same direction as the pattern. For approximate matches with
+--max-edits, overlapping alignments ending at adjacent positions are reported
+once, with the fewest edits.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		runGrep(cmd, args, true)
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
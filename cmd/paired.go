@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/eernst/catseq/pipeline"
+	"github.com/eernst/catseq/seqfile"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+// Helpers for commands that take either a single input or R1/R2 files of
+// paired-end reads, and write matching --out/--out2 outputs.
+
+func addPairedOutputFlags(cmd *cobra.Command, what string) {
+	cmd.Flags().StringP("out", "o", "-", "Write "+what+" records (R1 for paired input) to this file.")
+	cmd.Flags().StringP("out2", "", "", "Write "+what+" R2 records of paired input to this file.")
+}
+
+// pairedInputFileNames returns the one or two input files given in args, or
+// STDIN if there are none.
+func pairedInputFileNames(cmd *cobra.Command, args []string) []string {
+	switch len(args) {
+	case 0:
+		fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
+		return []string{"-"}
+	case 1, 2:
+		return args
+	}
+	fmt.Fprintf(os.Stderr, "Error: Wrong number of positional arguments given.\n")
+	cmd.Usage()
+	os.Exit(1)
+	return nil
+}
+
+// openReaders opens the input files, to be read in lockstep by
+// pipeline.ChannelRecSets. The caller closes them with closeReaders.
+func openReaders(fileNames []string) []pipeline.RecordReader {
+	seq.ValidateSeq = false
+	readers := make([]pipeline.RecordReader, len(fileNames))
+	for i, fileName := range fileNames {
+		var err error
+		readers[i], err = seqfile.NewReader(fileName, "")
+		check(err)
+	}
+	return readers
+}
+
+func closeReaders(readers []pipeline.RecordReader) {
+	for _, r := range readers {
+		r.(seqfile.Reader).Close()
+	}
+}
+
+// openPairedWriters opens --out, and --out2 for paired input. The caller
+// closes the writers.
+func openPairedWriters(cmd *cobra.Command, paired bool) []*xopen.Writer {
+	flags := cmd.Flags()
+	outFileName, err := flags.GetString("out")
+	check(err)
+	out2FileName, err := flags.GetString("out2")
+	check(err)
+	if paired && out2FileName == "" {
+		fmt.Fprintf(os.Stderr, "Error: Paired input requires --out2 for the R2 records.\n")
+		os.Exit(1)
+	}
+
+	writers := make([]*xopen.Writer, 1, 2)
+	writers[0], err = xopen.Wopen(outFileName)
+	check(err)
+	if paired {
+		w, err := xopen.Wopen(out2FileName)
+		check(err)
+		writers = append(writers, w)
+	}
+	return writers
+}
+
+func closeWriters(writers []*xopen.Writer) {
+	for _, w := range writers {
+		check(w.Close())
+	}
+}
+
+// writeRecSet writes each record of a set to the matching writer.
+func writeRecSet(writers []*xopen.Writer, set []*fastx.Record) {
+	for i, rec := range set {
+		rec.FormatToWriter(writers[i], LineWrap)
+	}
+}
+
+func recSetLength(set []*fastx.Record) (length int) {
+	for _, rec := range set {
+		length += rec.Seq.Length()
+	}
+	return length
+}
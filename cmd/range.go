@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eernst/catseq/seqfile"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(rangeCmd)
+}
+
+// parseRecordRange parses START:END, where either side may be omitted and
+// negative values count from the last record (-1).
+func parseRecordRange(s string) (start, end int, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("range %q is not of the form START:END", s)
+	}
+	start, end = 1, -1
+	if parts[0] != "" {
+		if start, err = strconv.Atoi(parts[0]); err != nil {
+			return 0, 0, fmt.Errorf("bad range start %q", parts[0])
+		}
+	}
+	if parts[1] != "" {
+		if end, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("bad range end %q", parts[1])
+		}
+	}
+	if start == 0 || end == 0 {
+		return 0, 0, fmt.Errorf("range %q: records are numbered from 1 (or -1 for the last)", s)
+	}
+	if (start > 0) == (end > 0) && start > end {
+		return 0, 0, fmt.Errorf("range %q: start is after end", s)
+	}
+	return start, end, nil
+}
+
+type indexedRecord struct {
+	index int
+	rec   *fastx.Record
+}
+
+// sliceRecords emits records start through end (1-based, inclusive; negative
+// values count from the last record). Reading stops as soon as end is reached,
+// so only as much of the input as needed is read. Slices relative to the end
+// of the input buffer at most |start| or |end| records.
+func sliceRecords(reader seqfile.Reader, start, end int, emit func(*fastx.Record)) {
+	read := func() *fastx.Record {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		check(err)
+		return rec.Clone()
+	}
+
+	switch {
+	case start > 0 && end > 0:
+		for i := 1; i <= end; i++ {
+			rec := read()
+			if rec == nil {
+				return
+			}
+			if i >= start {
+				emit(rec)
+			}
+		}
+	case start > 0:
+		// Hold back the last -end-1 records, which are past the end.
+		delay := -end - 1
+		var pending []*fastx.Record
+		for i := 1; ; i++ {
+			rec := read()
+			if rec == nil {
+				return
+			}
+			if i < start {
+				continue
+			}
+			pending = append(pending, rec)
+			if len(pending) > delay {
+				emit(pending[0])
+				pending = pending[1:]
+			}
+		}
+	default:
+		size := -start
+		ring := make([]indexedRecord, 0, size)
+		n := 0
+		for rec := read(); rec != nil; rec = read() {
+			n++
+			if len(ring) < size {
+				ring = append(ring, indexedRecord{n, rec})
+			} else {
+				ring[(n-1)%size] = indexedRecord{n, rec}
+			}
+		}
+		first, last := n+start+1, end
+		if end < 0 {
+			last = n + end + 1
+		}
+		for i := 0; i < len(ring); i++ {
+			r := ring[(n-len(ring)+i)%size]
+			if r.index >= first && r.index <= last {
+				emit(r.rec)
+			}
+		}
+	}
+}
+
+// runSlice writes records start through end of the input to STDOUT.
+func runSlice(cmd *cobra.Command, args []string, start, end int) {
+	var seqsInFileName string
+	switch len(args) {
+	case 0:
+		seqsInFileName = "-"
+		fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
+	case 1:
+		seqsInFileName = args[0]
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Wrong number of positional arguments given.\n")
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	seq.ValidateSeq = false
+	reader, err := seqfile.NewReader(seqsInFileName, "")
+	check(err)
+	defer reader.Close()
+
+	writer, err := xopen.Wopen("-") // "-" for STDOUT
+	check(err)
+	defer writer.Close()
+
+	sliceRecords(reader, start, end, func(rec *fastx.Record) {
+		rec.FormatToWriter(writer, LineWrap)
+	})
+}
+
+var rangeCmd = &cobra.Command{
+	Use:   "range START:END [SEQUENCE_FILE]",
+	Short: "Output a range of records from (multi-)sequence files.",
+	Long: `
+
+range outputs records START through END, counting records (not lines) from 1.
+Negative positions count back from the last record, and either end may be
+omitted:
+
+    catseq range 101:200 reads.fq     records 101 to 200
+    catseq range 1000: reads.fq       record 1000 onwards
+    catseq range -- -5:-2 reads.fq    fifth to second from last
+
+Note the "--", needed so that a negative START is not taken for a flag.
+
+Reading stops once END is reached.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		if len(args) < 1 {
+			fmt.Fprintf(os.Stderr, "Error: No range given.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		start, end, err := parseRecordRange(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		runSlice(cmd, args[1:], start, end)
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/eernst/catseq/seqfile"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(renameCmd)
+	renameCmd.Flags().StringP("search", "s", "", "Regular expression to search for in each header line.")
+	renameCmd.Flags().StringP("replace", "r", "", "Replacement for --search matches, which may refer to submatches as $1 or ${name}, and to the record number as {n}.")
+	renameCmd.Flags().StringP("prefix", "p", "", "Rename records sequentially to this prefix followed by the record number, e.g. \"seq\" for seq000001.")
+	renameCmd.Flags().IntP("width", "", 6, "Zero-pad record numbers to this many digits.")
+	renameCmd.Flags().IntP("start", "", 1, "Number of the first record.")
+	renameCmd.Flags().BoolP("keep-name", "k", false, "Keep the old ID as the first word of the description.")
+	renameCmd.Flags().BoolP("strip-desc", "d", false, "Remove descriptions, keeping just the IDs.")
+	renameCmd.Flags().StringP("map", "", "", "Write the old and new header lines of each record to this tab-separated file.")
+}
+
+// renamer rewrites record headers according to the rename flags.
+type renamer struct {
+	search    *regexp.Regexp
+	replace   []byte
+	prefix    string
+	width     int
+	keepName  bool
+	stripDesc bool
+	n         int
+}
+
+var recordNumberPattern = []byte("{n}")
+
+// splitName splits a header line into its ID and description, as fastx does.
+func splitName(name []byte) (id, desc []byte) {
+	if i := bytes.IndexAny(name, " \t"); i >= 0 {
+		return name[:i], bytes.TrimLeft(name[i:], " \t")
+	}
+	return name, nil
+}
+
+// rename returns the new header line of a record.
+func (r *renamer) rename(rec *fastx.Record) []byte {
+	number := []byte(fmt.Sprintf("%0*d", r.width, r.n))
+	r.n++
+
+	oldID := rec.ID
+	name := rec.Name
+	if r.stripDesc {
+		name = rec.ID
+	}
+	if r.search != nil {
+		replace := bytes.ReplaceAll(r.replace, recordNumberPattern, number)
+		name = r.search.ReplaceAll(name, replace)
+	}
+	id, desc := splitName(name)
+	if r.prefix != "" {
+		id = append([]byte(r.prefix), number...)
+	}
+	if r.stripDesc {
+		desc = nil
+	}
+	if r.keepName {
+		if desc != nil {
+			desc = append(append(append([]byte(nil), oldID...), ' '), desc...)
+		} else {
+			desc = oldID
+		}
+	}
+	newName := append([]byte(nil), id...)
+	if len(desc) > 0 {
+		newName = append(append(newName, ' '), desc...)
+	}
+	return newName
+}
+
+var renameCmd = &cobra.Command{
+	Use:   "rename [SEQUENCE_FILE]",
+	Short: "Rename records and rewrite their header lines.",
+	Long: `
+
+rename rewrites header lines, e.g. to make them acceptable to tools that choke
+on spaces, '|' or very long names. In order:
+
+  --strip-desc       removes descriptions, keeping just the IDs
+  --search/replace   replaces all matches of a regular expression in the
+                     header line; the replacement may use submatches ($1,
+                     ${name}) and the record number ({n})
+  --prefix           renames records to the prefix and the record number,
+                     keeping their descriptions (unless stripped)
+  --keep-name        keeps the old ID as the first word of the description
+
+Record numbers count from --start and are zero-padded to --width digits, e.g.
+"catseq rename --prefix contig_ --width 4" gives contig_0001, contig_0002...
+
+For example, to keep only the accessions of headers like
+"AB000263 |acc=AB000263|descr=...", use --strip-desc, and to replace runs of
+spaces and '|' by '_', use --search '[ |]+' --replace _.
+
+--map writes a tab-separated table of the old and new header lines, with
+column names "old" and "new" given --print-header.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		flags := cmd.Flags()
+		r := &renamer{}
+		search, err := flags.GetString("search")
+		check(err)
+		replace, err := flags.GetString("replace")
+		check(err)
+		r.prefix, err = flags.GetString("prefix")
+		check(err)
+		r.width, err = flags.GetInt("width")
+		check(err)
+		r.n, err = flags.GetInt("start")
+		check(err)
+		r.keepName, err = flags.GetBool("keep-name")
+		check(err)
+		r.stripDesc, err = flags.GetBool("strip-desc")
+		check(err)
+		mapFileName, err := flags.GetString("map")
+		check(err)
+
+		if search != "" {
+			if r.search, err = regexp.Compile(search); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Invalid --search expression: %v\n", err)
+				os.Exit(1)
+			}
+			r.replace = []byte(replace)
+		} else if flags.Changed("replace") {
+			fmt.Fprintf(os.Stderr, "Error: --replace requires --search.\n")
+			os.Exit(1)
+		}
+		if r.width < 0 {
+			fmt.Fprintf(os.Stderr, "Error: --width can't be negative.\n")
+			os.Exit(1)
+		}
+
+		var seqsInFileName string
+		switch len(args) {
+		case 0:
+			seqsInFileName = "-"
+			fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
+		case 1:
+			seqsInFileName = args[0]
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Wrong number of positional arguments given.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		seq.ValidateSeq = false
+		reader, err := seqfile.NewReader(seqsInFileName, "")
+		check(err)
+		defer reader.Close()
+
+		writer, err := xopen.Wopen("-") // "-" for STDOUT
+		check(err)
+		defer writer.Close()
+
+		var mapWriter *xopen.Writer
+		if mapFileName != "" {
+			mapWriter, err = xopen.Wopen(mapFileName)
+			check(err)
+			defer mapWriter.Close()
+			if PrintHeader {
+				fmt.Fprintf(mapWriter, "old\tnew\n")
+			}
+		}
+
+		for {
+			rec, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			check(err)
+			name := r.rename(rec)
+			if mapWriter != nil {
+				fmt.Fprintf(mapWriter, "%s\t%s\n", rec.Name, name)
+			}
+			rec.Name = name
+			rec.ID, _ = splitName(name)
+			rec.FormatToWriter(writer, LineWrap)
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/eernst/catseq/pipeline"
+	"github.com/eernst/catseq/seqfile"
+	"github.com/eernst/catseq/seqmath"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Values of --type
+	SeqTypeAuto string = "auto"
+	SeqTypeDNA         = "dna"
+	SeqTypeRNA         = "rna"
+)
+
+func init() {
+	RootCmd.AddCommand(revcompCmd)
+	revcompCmd.Flags().BoolP("only-complement", "", false, "Complement sequences without reversing them.")
+	revcompCmd.Flags().BoolP("only-reverse", "", false, "Reverse sequences (and qualities) without complementing them.")
+	revcompCmd.Flags().StringP("type", "t", SeqTypeAuto, "Sequence type, deciding whether A complements to T or U. One of \"auto\", \"dna\", or \"rna\".")
+	revcompCmd.Flags().BoolP("only-minus", "", false, "Only transform records whose header has the attribute strand=- (see --strand-tag), passing others through.")
+	revcompCmd.Flags().StringP("strand-tag", "", "strand", "Header attribute holding the strand for --only-minus.")
+	revcompCmd.Flags().StringP("suffix", "", "", "Append this suffix, e.g. \"/rc\", to the ID of each transformed record.")
+}
+
+// revcomper transforms records according to the revcomp flags.
+type revcomper struct {
+	reverse    bool
+	complement bool
+	seqType    string
+	onlyMinus  bool
+	strandTag  string
+	suffix     string
+}
+
+// transform reverses and/or complements a record in place, unless it is to be
+// passed through because it isn't on the minus strand.
+func (r *revcomper) transform(rec *fastx.Record) {
+	if r.onlyMinus {
+		strand, ok := pipeline.HeaderAttr(rec.Name, r.strandTag)
+		if !ok || !bytes.Equal(strand, []byte("-")) {
+			return
+		}
+	}
+	s := rec.Seq.Seq
+	if r.complement {
+		rna := r.seqType == SeqTypeRNA || (r.seqType == SeqTypeAuto && seqmath.IsRNA(s))
+		seqmath.Complement(s, s, rna)
+	}
+	if r.reverse {
+		seqmath.Reverse(s)
+		seqmath.Reverse(rec.Seq.Qual)
+	}
+	if r.suffix != "" {
+		id := append(append([]byte(nil), rec.ID...), r.suffix...)
+		rec.Name = append(append([]byte(nil), id...), rec.Name[len(rec.ID):]...)
+		rec.ID = id
+	}
+}
+
+var revcompCmd = &cobra.Command{
+	Use:   "revcomp [SEQUENCE_FILE]",
+	Short: "Reverse-complement, complement or reverse sequences.",
+	Long: `
+
+revcomp outputs the reverse complement of each input sequence, or with
+--only-complement or --only-reverse just its complement or reverse. FASTQ
+qualities are reversed along with their sequence.
+
+All IUPAC ambiguity codes are complemented (e.g. R to Y, B to V), case is
+preserved so soft-masked bases stay masked, and other characters such as gaps
+are left as they are. By default each sequence is complemented as RNA (A to U)
+if it contains U but no T, and as DNA otherwise; --type forces either.
+
+With --only-minus, only records tagged as being on the minus strand, such as
+those annotated "strand=-" by catseq grep --strand -, are transformed; others
+are passed through unchanged. --suffix marks transformed records by appending
+to their IDs, e.g. "read1/rc".
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		flags := cmd.Flags()
+		onlyComplement, err := flags.GetBool("only-complement")
+		check(err)
+		onlyReverse, err := flags.GetBool("only-reverse")
+		check(err)
+		if onlyComplement && onlyReverse {
+			fmt.Fprintf(os.Stderr, "Error: --only-complement and --only-reverse are mutually exclusive.\n")
+			os.Exit(1)
+		}
+		r := &revcomper{reverse: !onlyComplement, complement: !onlyReverse}
+		r.seqType, err = flags.GetString("type")
+		check(err)
+		switch r.seqType {
+		case SeqTypeAuto, SeqTypeDNA, SeqTypeRNA:
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Unknown sequence type %q.\n", r.seqType)
+			os.Exit(1)
+		}
+		r.onlyMinus, err = flags.GetBool("only-minus")
+		check(err)
+		r.strandTag, err = flags.GetString("strand-tag")
+		check(err)
+		r.suffix, err = flags.GetString("suffix")
+		check(err)
+
+		var seqsInFileName string
+		switch len(args) {
+		case 0:
+			seqsInFileName = "-"
+			fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
+		case 1:
+			seqsInFileName = args[0]
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Wrong number of positional arguments given.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		seq.ValidateSeq = false
+		reader, err := seqfile.NewReader(seqsInFileName, "")
+		check(err)
+		defer reader.Close()
+
+		writer, err := xopen.Wopen("-") // "-" for STDOUT
+		check(err)
+		defer writer.Close()
+
+		for {
+			rec, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			check(err)
+			r.transform(rec)
+			rec.FormatToWriter(writer, LineWrap)
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
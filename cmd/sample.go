@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eernst/catseq/pipeline"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(sampleCmd)
+	sampleCmd.Flags().Float64P("fraction", "f", -1, "Keep each record with this probability.")
+	sampleCmd.Flags().IntP("count", "n", -1, "Keep exactly this many records (or all, if there are fewer).")
+	sampleCmd.Flags().StringP("bases", "b", "", "Keep random records until this many bases are reached, e.g. 500M.")
+	sampleCmd.Flags().Float64P("coverage", "", -1, "Keep random records until this coverage of --genome-size is reached.")
+	sampleCmd.Flags().StringP("genome-size", "g", "", "Genome size used with --coverage, e.g. 4.6m or 3.1g.")
+	sampleCmd.Flags().Int64P("seed", "s", 11, "Seed for the random number generator.")
+	addPairedOutputFlags(sampleCmd, "sampled")
+}
+
+// parseSize parses a count of bases or bytes with an optional k, m, g or t
+// suffix (powers of 1000), e.g. "4.6m".
+func parseSize(s string) (int64, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "b")
+	mult := 1.0
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'k':
+			mult = 1e3
+		case 'm':
+			mult = 1e6
+		case 'g':
+			mult = 1e9
+		case 't':
+			mult = 1e12
+		}
+		if mult > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+	v, err := strconv.ParseFloat(str, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * mult), nil
+}
+
+// sampleReservoir keeps a uniform random sample of n record sets using
+// reservoir sampling (Algorithm R), tracking input order so the sample can be
+// written in the order it was read.
+type sampleReservoir struct {
+	n     int
+	seen  int
+	index []int
+	sets  [][]*fastx.Record
+	rng   *rand.Rand
+}
+
+func (r *sampleReservoir) add(set []*fastx.Record) {
+	if len(r.sets) < r.n {
+		r.sets = append(r.sets, set)
+		r.index = append(r.index, r.seen)
+	} else if j := r.rng.Intn(r.seen + 1); j < r.n {
+		r.sets[j] = set
+		r.index[j] = r.seen
+	}
+	r.seen++
+}
+
+func (r *sampleReservoir) Len() int           { return len(r.sets) }
+func (r *sampleReservoir) Less(i, j int) bool { return r.index[i] < r.index[j] }
+func (r *sampleReservoir) Swap(i, j int) {
+	r.index[i], r.index[j] = r.index[j], r.index[i]
+	r.sets[i], r.sets[j] = r.sets[j], r.sets[i]
+}
+
+// chooseByBases shuffles the record sets with the given lengths and picks them
+// in random order until the target number of bases is reached.
+func chooseByBases(lengths []int, target int64, rng *rand.Rand) []bool {
+	chosen := make([]bool, len(lengths))
+	var total int64
+	for _, i := range rng.Perm(len(lengths)) {
+		if total >= target {
+			break
+		}
+		chosen[i] = true
+		total += int64(lengths[i])
+	}
+	return chosen
+}
+
+var sampleCmd = &cobra.Command{
+	Use:   "sample [SEQUENCE_FILE [SEQUENCE_FILE_R2]]",
+	Short: "Randomly subsample records from (multi-)sequence files.",
+	Long: `
+
+sample writes a random subset of the input records, in input order. Exactly
+one of the following selects the size of the subset:
+
+  --fraction F     keep each record independently with probability F
+  --count N        keep N records, chosen by reservoir sampling
+  --bases B        keep random records until B bases are reached
+  --coverage X     with --genome-size G, same as --bases X*G
+
+The same --seed always gives the same sample of the same input. Given two
+files, they are treated as R1/R2 of paired-end reads and both mates of a pair
+are kept or dropped together.
+
+--bases and --coverage read input files twice, first to learn the read
+lengths; input on STDIN is held in memory instead.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		flags := cmd.Flags()
+		fraction, err := flags.GetFloat64("fraction")
+		check(err)
+		count, err := flags.GetInt("count")
+		check(err)
+		basesStr, err := flags.GetString("bases")
+		check(err)
+		coverage, err := flags.GetFloat64("coverage")
+		check(err)
+		genomeSizeStr, err := flags.GetString("genome-size")
+		check(err)
+		seed, err := flags.GetInt64("seed")
+		check(err)
+
+		if basesStr != "" && (coverage >= 0 || genomeSizeStr != "") {
+			fmt.Fprintf(os.Stderr, "Error: Give either --bases, or --coverage with --genome-size, not both.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		var targetBases int64 = -1
+		switch {
+		case basesStr != "":
+			targetBases, err = parseSize(basesStr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: --bases: %v\n", err)
+				os.Exit(1)
+			}
+		case coverage < 0 && genomeSizeStr != "":
+			fmt.Fprintf(os.Stderr, "Error: --genome-size is only used with --coverage.\n")
+			os.Exit(1)
+		case coverage >= 0:
+			if genomeSizeStr == "" {
+				fmt.Fprintf(os.Stderr, "Error: --coverage requires --genome-size.\n")
+				os.Exit(1)
+			}
+			genomeSize, err := parseSize(genomeSizeStr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: --genome-size: %v\n", err)
+				os.Exit(1)
+			}
+			targetBases = int64(coverage * float64(genomeSize))
+		}
+
+		modes := 0
+		for _, set := range []bool{fraction >= 0, count >= 0, targetBases >= 0} {
+			if set {
+				modes++
+			}
+		}
+		if modes != 1 {
+			fmt.Fprintf(os.Stderr, "Error: Give exactly one of --fraction, --count, or --bases/--coverage.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if fraction > 1 {
+			fmt.Fprintf(os.Stderr, "Error: --fraction must be between 0 and 1.\n")
+			os.Exit(1)
+		}
+
+		seqsInFileNames := pairedInputFileNames(cmd, args)
+		readers := openReaders(seqsInFileNames)
+		defer closeReaders(readers)
+		writers := openPairedWriters(cmd, len(readers) == 2)
+		defer closeWriters(writers)
+
+		rng := rand.New(rand.NewSource(seed))
+		var in, out, outBases int
+		emit := func(set []*fastx.Record) {
+			writeRecSet(writers, set)
+			out++
+			outBases += recSetLength(set)
+		}
+
+		switch {
+		case fraction >= 0:
+			for set := range pipeline.ChannelRecSets(readers...) {
+				in++
+				if rng.Float64() < fraction {
+					emit(set)
+				}
+			}
+		case count >= 0:
+			reservoir := &sampleReservoir{n: count, rng: rng}
+			for set := range pipeline.ChannelRecSets(readers...) {
+				in++
+				reservoir.add(set)
+			}
+			sort.Sort(reservoir)
+			for _, set := range reservoir.sets {
+				emit(set)
+			}
+		default:
+			var lengths []int
+			var held [][]*fastx.Record
+			fromStdin := seqsInFileNames[0] == "-"
+			for set := range pipeline.ChannelRecSets(readers...) {
+				lengths = append(lengths, recSetLength(set))
+				if fromStdin {
+					held = append(held, set)
+				}
+			}
+			in = len(lengths)
+			chosen := chooseByBases(lengths, targetBases, rng)
+			if fromStdin {
+				for i, set := range held {
+					if chosen[i] {
+						emit(set)
+					}
+				}
+			} else {
+				i := 0
+				readers := openReaders(seqsInFileNames)
+				for set := range pipeline.ChannelRecSets(readers...) {
+					if chosen[i] {
+						emit(set)
+					}
+					i++
+				}
+				closeReaders(readers)
+			}
+		}
+
+		if Verbose {
+			fmt.Fprintf(os.Stderr, "Sampled %d of %d records (%d bases).\n", out, in, outBases)
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/eernst/catseq/seqfile"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	SortByName        string = "name"
+	SortByNaturalName        = "natural-name"
+	SortByLength             = "length"
+	SortBySeq                = "seq"
+	SortByGC                 = "gc"
+	SortByMeanQ              = "meanq"
+)
+
+func init() {
+	RootCmd.AddCommand(sortCmd)
+	sortCmd.Flags().StringP("by", "b", SortByName, "Sort key. One of \"name\", \"natural-name\", \"length\", \"seq\", \"gc\" or \"meanq\".")
+	sortCmd.Flags().BoolP("reverse", "r", false, "Sort in descending order.")
+	sortCmd.Flags().BoolP("ignore-case", "i", false, "Ignore case when sorting by name or sequence.")
+	sortCmd.Flags().StringP("max-mem", "m", "1g", "Sort in memory up to about this many bytes of records, then spill sorted runs to temporary files, e.g. 500m.")
+	sortCmd.Flags().StringP("temp-dir", "", "", "Write temporary runs to this directory. (default the system temporary directory)")
+}
+
+// sortRec is a record with its sort key.
+type sortRec struct {
+	rec *fastx.Record
+	str []byte
+	num float64
+}
+
+// sorter computes and compares sort keys.
+type sorter struct {
+	by         string
+	reverse    bool
+	ignoreCase bool
+}
+
+func (s *sorter) key(rec *fastx.Record) sortRec {
+	r := sortRec{rec: rec}
+	switch s.by {
+	case SortByName, SortByNaturalName:
+		r.str = rec.Name
+	case SortBySeq:
+		r.str = rec.Seq.Seq
+	case SortByLength:
+		r.num = float64(rec.Seq.Length())
+	case SortByGC:
+		r.num = newInfoRecord(rec).GcRatio
+	case SortByMeanQ:
+		r.num = newInfoRecord(rec).MeanBaseQual
+	}
+	if s.ignoreCase && r.str != nil {
+		r.str = bytes.ToUpper(r.str)
+	}
+	return r
+}
+
+// compare orders two keys, with NaN (e.g. the GC content of a sequence of Ns)
+// before any number.
+func (s *sorter) compare(a, b *sortRec) (c int) {
+	switch s.by {
+	case SortByName, SortBySeq:
+		c = bytes.Compare(a.str, b.str)
+	case SortByNaturalName:
+		c = naturalCompare(a.str, b.str)
+	default:
+		switch aNaN, bNaN := math.IsNaN(a.num), math.IsNaN(b.num); {
+		case aNaN || bNaN:
+			if aNaN && !bNaN {
+				c = -1
+			} else if bNaN && !aNaN {
+				c = 1
+			}
+		case a.num < b.num:
+			c = -1
+		case a.num > b.num:
+			c = 1
+		}
+	}
+	if s.reverse {
+		c = -c
+	}
+	return c
+}
+
+// naturalCompare compares names treating runs of digits as numbers, so that
+// "chr2" sorts before "chr10".
+func naturalCompare(a, b []byte) int {
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	for len(a) > 0 && len(b) > 0 {
+		if !isDigit(a[0]) || !isDigit(b[0]) {
+			if a[0] != b[0] {
+				if a[0] < b[0] {
+					return -1
+				}
+				return 1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		var i, j int
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		na, nb := bytes.TrimLeft(a[:i], "0"), bytes.TrimLeft(b[:j], "0")
+		if len(na) != len(nb) {
+			if len(na) < len(nb) {
+				return -1
+			}
+			return 1
+		}
+		if c := bytes.Compare(na, nb); c != 0 {
+			return c
+		}
+		// Equal numbers: fewer leading zeros first.
+		if i != j {
+			if i < j {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[i:], b[j:]
+	}
+	return len(a) - len(b)
+}
+
+// sortRecSize estimates the memory held by a record.
+func sortRecSize(rec *fastx.Record) int64 {
+	return int64(len(rec.Name)+len(rec.Seq.Seq)+len(rec.Seq.Qual)) + 128
+}
+
+// writeSortRun writes sorted records to a temporary file, which check removes
+// if anything fails.
+func writeSortRun(recs []sortRec, dir string) string {
+	f, err := createTemp(dir, "catseq-sort-*.fx")
+	check(err)
+	f.Close()
+	w, err := xopen.Wopen(f.Name())
+	check(err)
+	for _, r := range recs {
+		r.rec.FormatToWriter(w, 0)
+	}
+	check(w.Close())
+	return f.Name()
+}
+
+// sortRun is a sorted temporary file being merged.
+type sortRun struct {
+	index  int
+	reader *fastx.Reader
+	head   sortRec
+}
+
+// next reads the next record of the run, returning false at its end.
+func (r *sortRun) next(s *sorter) bool {
+	rec, err := r.reader.Read()
+	if err == io.EOF {
+		return false
+	}
+	check(err)
+	r.head = s.key(rec.Clone())
+	return true
+}
+
+// sortRunHeap orders runs by their next records, and ties by run, which
+// keeps the sort stable since earlier runs hold earlier input.
+type sortRunHeap struct {
+	s    *sorter
+	runs []*sortRun
+}
+
+func (h *sortRunHeap) Len() int { return len(h.runs) }
+func (h *sortRunHeap) Less(i, j int) bool {
+	if c := h.s.compare(&h.runs[i].head, &h.runs[j].head); c != 0 {
+		return c < 0
+	}
+	return h.runs[i].index < h.runs[j].index
+}
+func (h *sortRunHeap) Swap(i, j int) { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *sortRunHeap) Push(x any)    { h.runs = append(h.runs, x.(*sortRun)) }
+func (h *sortRunHeap) Pop() any {
+	run := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return run
+}
+
+// mergeSortRuns merges sorted temporary files, writing each record in turn.
+func mergeSortRuns(s *sorter, fileNames []string, emit func(*fastx.Record)) {
+	h := &sortRunHeap{s: s}
+	for i, fileName := range fileNames {
+		reader, err := fastx.NewDefaultReader(fileName)
+		check(err)
+		run := &sortRun{index: i, reader: reader}
+		if run.next(s) {
+			h.runs = append(h.runs, run)
+		} else {
+			reader.Close()
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 0 {
+		run := h.runs[0]
+		emit(run.head.rec)
+		if run.next(s) {
+			heap.Fix(h, 0)
+		} else {
+			run.reader.Close()
+			heap.Pop(h)
+		}
+	}
+}
+
+var sortCmd = &cobra.Command{
+	Use:   "sort [SEQUENCE_FILE]",
+	Short: "Sort records of (multi-)sequence files.",
+	Long: `
+
+sort writes the input records ordered by one of:
+
+  name           full header line, byte by byte
+  natural-name   header line with runs of digits compared as numbers,
+                 e.g. chr2 before chr10
+  length         sequence length
+  seq            sequence
+  gc             GC content, as reported by info (NaN for all-N sequences,
+                 which sort lowest)
+  meanq          mean base quality, as reported by info
+
+Records with equal keys keep their input order, and --reverse sorts in
+descending order.
+
+Records are sorted in memory until they take more than about --max-mem bytes,
+after which each batch is sorted and written to a temporary file in
+--temp-dir, and the batches are finally merged.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		flags := cmd.Flags()
+		s := &sorter{}
+		var err error
+		s.by, err = flags.GetString("by")
+		check(err)
+		s.reverse, err = flags.GetBool("reverse")
+		check(err)
+		s.ignoreCase, err = flags.GetBool("ignore-case")
+		check(err)
+		maxMemStr, err := flags.GetString("max-mem")
+		check(err)
+		tempDir, err := flags.GetString("temp-dir")
+		check(err)
+
+		switch s.by {
+		case SortByName, SortByNaturalName, SortByLength, SortBySeq, SortByGC, SortByMeanQ:
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Unknown sort key %q.\n", s.by)
+			os.Exit(1)
+		}
+		maxMem, err := parseSize(maxMemStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --max-mem: %v\n", err)
+			os.Exit(1)
+		}
+
+		var seqsInFileName string
+		switch len(args) {
+		case 0:
+			fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
+			seqsInFileName = "-"
+		case 1:
+			seqsInFileName = args[0]
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Wrong number of positional arguments given.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		seq.ValidateSeq = false
+		reader, err := seqfile.NewReader(seqsInFileName, "")
+		check(err)
+
+		var recs []sortRec
+		var size int64
+		var runs []string
+		defer func() {
+			for _, fileName := range runs {
+				removeTemp(fileName)
+			}
+		}()
+		sortRecs := func() {
+			sort.SliceStable(recs, func(i, j int) bool { return s.compare(&recs[i], &recs[j]) < 0 })
+		}
+		for {
+			rec, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			check(err)
+			rec = rec.Clone()
+			recs = append(recs, s.key(rec))
+			size += sortRecSize(rec)
+			if size > maxMem {
+				sortRecs()
+				runs = append(runs, writeSortRun(recs, tempDir))
+				recs, size = nil, 0
+			}
+		}
+		sortRecs()
+
+		writer, err := xopen.Wopen("-") // "-" for STDOUT
+		check(err)
+		defer writer.Close()
+		emit := func(rec *fastx.Record) {
+			rec.FormatToWriter(writer, LineWrap)
+		}
+		if runs == nil {
+			for _, r := range recs {
+				emit(r.rec)
+			}
+		} else {
+			if len(recs) > 0 {
+				runs = append(runs, writeSortRun(recs, tempDir))
+				recs = nil
+			}
+			if Verbose {
+				fmt.Fprintf(os.Stderr, "Merging %d sorted runs.\n", len(runs))
+			}
+			mergeSortRuns(s, runs, emit)
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -0,0 +1,405 @@
+package cmd
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eernst/catseq/pipeline"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(splitCmd)
+	splitCmd.Flags().IntP("by-count", "n", -1, "Write this many records (or read pairs) per part.")
+	splitCmd.Flags().IntP("by-parts", "p", -1, "Split into this many parts with about the same number of records.")
+	splitCmd.Flags().StringP("by-bases", "b", "", "Start a new part before exceeding this many bases, e.g. 500M.")
+	splitCmd.Flags().BoolP("by-id", "i", false, "Write the records of each ID to their own part.")
+	splitCmd.Flags().StringP("out-dir", "O", ".", "Write parts to this directory, creating it if needed.")
+	splitCmd.Flags().StringP("prefix", "", "", "Prefix of the part file names. (default the input file name without extensions)")
+	splitCmd.Flags().StringP("compress", "z", "", "Compress parts with \"gz\", \"xz\", \"zst\" or \"bz2\", or \"none\". (default as the input)")
+	splitCmd.Flags().StringP("manifest", "", "", "Write the manifest to this file. (default PREFIX.manifest.tsv in --out-dir)")
+}
+
+// splitPart is an output part, with one file per input.
+type splitPart struct {
+	label   string
+	files   []string
+	writers []*xopen.Writer
+	used    *list.Element // in splitter.open while writers are open
+	records int
+	bases   []int64
+}
+
+// splitMaxOpenParts is the number of parts whose files are kept open at a
+// time, so that splitting by read-level IDs doesn't run out of file
+// descriptors.
+const splitMaxOpenParts = 256
+
+// splitter writes record sets to numbered or per-ID parts, opening each part's
+// files when its first record arrives. Once splitMaxOpenParts parts are open,
+// the least recently written one is closed, to be reopened for appending if
+// more of its records arrive.
+type splitter struct {
+	outDir   string
+	prefixes []string // per input
+	ext      string
+	compress string
+	width    int
+	parts    []*splitPart
+	byKey    map[string]*splitPart // by part number or record ID
+	labels   map[string]bool
+	open     *list.List // of open parts, most recently written first
+}
+
+// splitCompressionExts are the compression extensions xopen recognizes.
+var splitCompressionExts = []string{".gz", ".xz", ".zst", ".bz2"}
+
+// splitFileName separates the name of an input file into its prefix, its
+// sequence format extension and its compression extension, e.g.
+// "reads_R1.fq.gz" into "reads_R1", ".fq" and ".gz".
+func splitFileName(fileName string) (prefix, ext, compression string) {
+	prefix = filepath.Base(fileName)
+	for _, e := range splitCompressionExts {
+		if strings.HasSuffix(prefix, e) {
+			prefix, compression = strings.TrimSuffix(prefix, e), e
+			break
+		}
+	}
+	switch e := filepath.Ext(prefix); strings.ToLower(e) {
+	case ".fastq", ".fq", ".fasta", ".fa", ".fna", ".faa":
+		prefix, ext = strings.TrimSuffix(prefix, e), e
+	}
+	return prefix, ext, compression
+}
+
+// safeFileName replaces characters that are awkward in file names, for parts
+// named by ID.
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// label returns the name of the part for a record ID, made safe for file
+// names. Different IDs that are the same once made safe, such as "a:b" and
+// "a_b", get parts numbered from "_2" on.
+func (s *splitter) label(id string) string {
+	label := safeFileName(id)
+	for i := 2; s.labels[label]; i++ {
+		label = fmt.Sprintf("%s_%d", safeFileName(id), i)
+	}
+	return label
+}
+
+// part returns the part for key, a part label or with byID a record ID, with
+// its files open.
+func (s *splitter) part(key string, set []*fastx.Record, byID bool) *splitPart {
+	p, ok := s.byKey[key]
+	if !ok {
+		if s.ext == "" {
+			s.ext = ".fasta"
+			if len(set[0].Seq.Qual) > 0 {
+				s.ext = ".fastq"
+			}
+		}
+		label := key
+		if byID {
+			label = s.label(key)
+		}
+		p = &splitPart{label: label, bases: make([]int64, len(set))}
+		for _, prefix := range s.prefixes {
+			p.files = append(p.files, filepath.Join(s.outDir, prefix+"."+label+s.ext+s.compress))
+		}
+		s.parts = append(s.parts, p)
+		s.byKey[key] = p
+		s.labels[label] = true
+	}
+	if p.writers != nil {
+		s.open.MoveToFront(p.used)
+		return p
+	}
+
+	if s.open.Len() >= splitMaxOpenParts {
+		s.close(s.open.Back().Value.(*splitPart))
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if p.records > 0 {
+		// Compressed files are appended to as another stream.
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	for _, fileName := range p.files {
+		w, err := xopen.WopenFile(fileName, flag, 0o666)
+		check(err)
+		p.writers = append(p.writers, w)
+	}
+	p.used = s.open.PushFront(p)
+	return p
+}
+
+// numbered returns the label of the i'th numbered part, counting from 0.
+func (s *splitter) numbered(i int) string {
+	return fmt.Sprintf("part_%0*d", s.width, i+1)
+}
+
+func (s *splitter) write(p *splitPart, set []*fastx.Record) {
+	writeRecSet(p.writers, set)
+	p.records++
+	for i, rec := range set {
+		p.bases[i] += int64(rec.Seq.Length())
+	}
+}
+
+// close closes the files of a part once it is full, so that splitting by
+// count or bases keeps only one part open at a time, or to make room for
+// another part.
+func (s *splitter) close(p *splitPart) {
+	if p.writers != nil {
+		closeWriters(p.writers)
+		p.writers = nil
+		s.open.Remove(p.used)
+		p.used = nil
+	}
+}
+
+func (s *splitter) closeAll() {
+	for _, p := range s.parts {
+		s.close(p)
+	}
+}
+
+// writeManifest writes one line per part file with its record and base
+// counts.
+func (s *splitter) writeManifest(fileName string) {
+	w, err := xopen.Wopen(fileName)
+	check(err)
+	fmt.Fprintf(w, "part\tfile\trecords\tbases\n")
+	for _, p := range s.parts {
+		for i, file := range p.files {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", p.label, file, p.records, p.bases[i])
+		}
+	}
+	check(w.Close())
+}
+
+var splitCmd = &cobra.Command{
+	Use:   "split [SEQUENCE_FILE [SEQUENCE_FILE_R2]]",
+	Short: "Split (multi-)sequence files into parts.",
+	Long: `
+
+split writes the input records to numbered files, e.g. for scatter-gather
+jobs. Exactly one of the following decides where each part ends:
+
+  --by-count N    N records per part
+  --by-parts N    N parts with about the same number of records
+  --by-bases B    as many records per part as fit in B bases (at least one)
+  --by-id         one part per record ID, named after the ID
+
+Parts are written to --out-dir as PREFIX.part_001.fastq and so on, where
+PREFIX and the extension are taken from the input file name (or "stdin"), and
+are compressed as the input is unless --compress says otherwise. With
+--by-id, parts are named PREFIX.ID.fastq instead, with characters other than
+letters, digits, '.', '-' and '_' in IDs replaced by '_'. IDs that are then
+the same, such as "a:b" and "a_b", get parts ID_2, ID_3 and so on in order of
+appearance. At most 256 parts are held open at a time; the files of others
+are reopened as needed to append to them.
+
+Given two files, they are treated as R1/R2 of paired-end reads and the mates
+of a pair always go to parts with the same number, named after their own
+input file. Counts are of read pairs, and bases of both mates together.
+
+A manifest is written listing each part file with its numbers of records and
+bases, as tab-separated columns "part", "file", "records" and "bases".
+
+--by-parts reads input files twice, first to count the records; input on
+STDIN is held in memory instead.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		flags := cmd.Flags()
+		byCount, err := flags.GetInt("by-count")
+		check(err)
+		byParts, err := flags.GetInt("by-parts")
+		check(err)
+		byBasesStr, err := flags.GetString("by-bases")
+		check(err)
+		byID, err := flags.GetBool("by-id")
+		check(err)
+		outDir, err := flags.GetString("out-dir")
+		check(err)
+		prefix, err := flags.GetString("prefix")
+		check(err)
+		compress, err := flags.GetString("compress")
+		check(err)
+		manifestFileName, err := flags.GetString("manifest")
+		check(err)
+
+		var byBases int64 = -1
+		if byBasesStr != "" {
+			if byBases, err = parseSize(byBasesStr); err != nil || byBases < 1 {
+				fmt.Fprintf(os.Stderr, "Error: --by-bases: invalid size %q.\n", byBasesStr)
+				os.Exit(1)
+			}
+		}
+		modes := 0
+		for _, set := range []bool{byCount >= 0, byParts >= 0, byBases >= 0, byID} {
+			if set {
+				modes++
+			}
+		}
+		if modes != 1 {
+			fmt.Fprintf(os.Stderr, "Error: Give exactly one of --by-count, --by-parts, --by-bases or --by-id.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if byCount == 0 || byParts == 0 {
+			fmt.Fprintf(os.Stderr, "Error: Parts must hold at least one record.\n")
+			os.Exit(1)
+		}
+		switch compress {
+		case "", "none":
+		case "gz", "xz", "zst", "bz2":
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Unknown compression %q.\n", compress)
+			os.Exit(1)
+		}
+
+		seqsInFileNames := pairedInputFileNames(cmd, args)
+		s := &splitter{
+			outDir: outDir,
+			width:  3,
+			byKey:  make(map[string]*splitPart),
+			labels: make(map[string]bool),
+			open:   list.New(),
+		}
+		for i, fileName := range seqsInFileNames {
+			p, ext, compression := "stdin", "", ""
+			if fileName != "-" {
+				p, ext, compression = splitFileName(fileName)
+			}
+			if i == 0 {
+				s.ext, s.compress = ext, compression
+			}
+			s.prefixes = append(s.prefixes, p)
+		}
+		if prefix != "" {
+			s.prefixes[0] = prefix
+			if len(s.prefixes) == 2 {
+				s.prefixes[1] = prefix
+			}
+		}
+		if len(s.prefixes) == 2 && s.prefixes[0] == s.prefixes[1] {
+			s.prefixes[0] += "_R1"
+			s.prefixes[1] += "_R2"
+		}
+		switch compress {
+		case "":
+		case "none":
+			s.compress = ""
+		default:
+			s.compress = "." + compress
+		}
+		if byParts > 0 {
+			if digits := len(fmt.Sprint(byParts)); digits > s.width {
+				s.width = digits
+			}
+		}
+		check(os.MkdirAll(outDir, 0o755))
+
+		readers := openReaders(seqsInFileNames)
+		defer closeReaders(readers)
+		var in int
+		switch {
+		case byCount > 0:
+			for set := range pipeline.ChannelRecSets(readers...) {
+				p := s.part(s.numbered(in/byCount), set, false)
+				s.write(p, set)
+				if p.records == byCount {
+					s.close(p)
+				}
+				in++
+			}
+		case byBases > 0:
+			var p *splitPart
+			var bases int64
+			for set := range pipeline.ChannelRecSets(readers...) {
+				length := int64(recSetLength(set))
+				if p != nil && bases+length > byBases {
+					s.close(p)
+					p = nil
+				}
+				if p == nil {
+					p, bases = s.part(s.numbered(len(s.parts)), set, false), 0
+				}
+				s.write(p, set)
+				bases += length
+				in++
+			}
+		case byParts > 0:
+			// Part i holds records [i*n/parts, (i+1)*n/parts).
+			var held [][]*fastx.Record
+			fromStdin := seqsInFileNames[0] == "-"
+			for set := range pipeline.ChannelRecSets(readers...) {
+				if fromStdin {
+					held = append(held, set)
+				}
+				in++
+			}
+			sets := make(chan []*fastx.Record)
+			go func() {
+				if fromStdin {
+					for _, set := range held {
+						sets <- set
+					}
+				} else {
+					readers := openReaders(seqsInFileNames)
+					for set := range pipeline.ChannelRecSets(readers...) {
+						sets <- set
+					}
+					closeReaders(readers)
+				}
+				close(sets)
+			}()
+			i, part := 0, 0
+			for set := range sets {
+				for int64(i) >= int64(part+1)*int64(in)/int64(byParts) {
+					part++
+				}
+				s.write(s.part(s.numbered(part), set, false), set)
+				i++
+			}
+		default:
+			for set := range pipeline.ChannelRecSets(readers...) {
+				s.write(s.part(string(set[0].ID), set, true), set)
+				in++
+			}
+		}
+		s.closeAll()
+
+		if manifestFileName == "" {
+			manifestFileName = filepath.Join(outDir, s.prefixes[0]+".manifest.tsv")
+		}
+		s.writeManifest(manifestFileName)
+
+		if Verbose {
+			fmt.Fprintf(os.Stderr, "Split %d records into %d parts.\n", in, len(s.parts))
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
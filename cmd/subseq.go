@@ -0,0 +1,465 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eernst/catseq/annot"
+	"github.com/eernst/catseq/faidx"
+	"github.com/eernst/catseq/seqmath"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(subseqCmd)
+	addRegionFlags(subseqCmd)
+	subseqCmd.Flags().StringP("bed", "", "", "Extract the features of this BED file.")
+	subseqCmd.Flags().StringP("gff", "", "", "Extract the features of this GFF3 file.")
+	subseqCmd.Flags().StringP("gtf", "", "", "Extract the features of this GTF file.")
+	subseqCmd.Flags().StringP("feature-type", "t", "", "Only extract GFF3/GTF features of these comma-separated types, e.g. \"CDS\" or \"exon\".")
+	subseqCmd.Flags().StringArrayP("attr", "", nil, "Only extract features with this KEY=VALUE attribute (\"name\" for the BED name). Repeat to require several.")
+	subseqCmd.Flags().BoolP("stitch", "", false, "Join the features of one --feature-type of each transcript (see --group-by), or the blocks of BED12 lines, in strand order.")
+	subseqCmd.Flags().StringP("group-by", "", "", "Attribute grouping features to stitch. (default \"Parent\" for GFF3, \"transcript_id\" for GTF)")
+	subseqCmd.Flags().StringP("name-attr", "", "", "Attribute naming output records. (default \"ID\" or \"Name\" for GFF3, \"transcript_id\" or \"gene_id\" for GTF)")
+	subseqCmd.Flags().Int64P("flank", "", 0, "Add this many bases on both sides of each feature.")
+	subseqCmd.Flags().Int64P("upstream", "", 0, "Add this many bases upstream (5') of each feature, taking its strand into account.")
+	subseqCmd.Flags().Int64P("downstream", "", 0, "Add this many bases downstream (3') of each feature, taking its strand into account.")
+}
+
+// annotRegion is a feature, or stitched features, to extract.
+type annotRegion struct {
+	name   string
+	seq    string
+	strand byte
+	typ    string
+	parts  []annot.Block // in genomic order
+}
+
+// location formats the parts of the region with 1-based, inclusive
+// coordinates, e.g. "chr1:101-200,301-400".
+func (a *annotRegion) location() string {
+	var b strings.Builder
+	b.WriteString(a.seq)
+	for i, p := range a.parts {
+		if i == 0 {
+			b.WriteByte(':')
+		} else {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%d-%d", p.Start+1, p.End)
+	}
+	return b.String()
+}
+
+// annotOptions are the subseq flags applying to annotations.
+type annotOptions struct {
+	format     annot.Format
+	types      map[string]bool
+	attrs      []annot.Attr
+	stitch     bool
+	groupBy    string
+	nameAttrs  []string
+	upstream   int64
+	downstream int64
+}
+
+func getAnnotOptions(cmd *cobra.Command) (fileName string, opts annotOptions) {
+	flags := cmd.Flags()
+	var given int
+	for _, f := range []struct {
+		flag   string
+		format annot.Format
+	}{{"bed", annot.BED}, {"gff", annot.GFF3}, {"gtf", annot.GTF}} {
+		name, err := flags.GetString(f.flag)
+		check(err)
+		if name != "" {
+			fileName, opts.format = name, f.format
+			given++
+		}
+	}
+	if given > 1 {
+		fmt.Fprintf(os.Stderr, "Error: --bed, --gff and --gtf are mutually exclusive.\n")
+		os.Exit(1)
+	}
+
+	types, err := flags.GetString("feature-type")
+	check(err)
+	if types != "" {
+		if opts.format == annot.BED {
+			fmt.Fprintf(os.Stderr, "Error: BED features have no type; use --attr name=... to select them by name.\n")
+			os.Exit(1)
+		}
+		opts.types = make(map[string]bool)
+		for _, t := range strings.Split(types, ",") {
+			opts.types[strings.TrimSpace(t)] = true
+		}
+	}
+	attrs, err := flags.GetStringArray("attr")
+	check(err)
+	for _, a := range attrs {
+		key, value, ok := strings.Cut(a, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Error: --attr %q is not of the form KEY=VALUE.\n", a)
+			os.Exit(1)
+		}
+		opts.attrs = append(opts.attrs, annot.Attr{Key: key, Value: value})
+	}
+
+	opts.stitch, err = flags.GetBool("stitch")
+	check(err)
+	if opts.stitch && opts.format != annot.BED && len(opts.types) != 1 {
+		// Otherwise e.g. the exons and CDSs of a transcript would be joined
+		// into one sequence.
+		fmt.Fprintf(os.Stderr, "Error: --stitch needs a single --feature-type, e.g. exon or CDS.\n")
+		os.Exit(1)
+	}
+	opts.groupBy, err = flags.GetString("group-by")
+	check(err)
+	nameAttr, err := flags.GetString("name-attr")
+	check(err)
+	switch {
+	case nameAttr != "":
+		opts.nameAttrs = []string{nameAttr}
+	case opts.format == annot.GFF3:
+		opts.nameAttrs = []string{"ID", "Name"}
+	case opts.format == annot.GTF:
+		opts.nameAttrs = []string{"transcript_id", "gene_id"}
+	default:
+		opts.nameAttrs = []string{"name"}
+	}
+	if opts.groupBy == "" {
+		opts.groupBy = "Parent"
+		if opts.format == annot.GTF {
+			opts.groupBy = "transcript_id"
+		}
+	}
+
+	flank, err := flags.GetInt64("flank")
+	check(err)
+	opts.upstream, err = flags.GetInt64("upstream")
+	check(err)
+	opts.downstream, err = flags.GetInt64("downstream")
+	check(err)
+	if !flags.Changed("upstream") {
+		opts.upstream = flank
+	}
+	if !flags.Changed("downstream") {
+		opts.downstream = flank
+	}
+	if opts.upstream < 0 || opts.downstream < 0 {
+		fmt.Fprintf(os.Stderr, "Error: Flanks can't be negative.\n")
+		os.Exit(1)
+	}
+	return fileName, opts
+}
+
+// selected reports whether a feature passes --feature-type and --attr.
+func (opts *annotOptions) selected(f *annot.Feature) bool {
+	if opts.types != nil && !opts.types[f.Type] {
+		return false
+	}
+	for _, a := range opts.attrs {
+		if !f.HasAttr(a.Key, a.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (opts *annotOptions) featureName(f *annot.Feature) string {
+	for _, key := range opts.nameAttrs {
+		if name, ok := f.Attr(key); ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// annotRegions selects and, with --stitch, groups the features of an
+// annotation file into the regions to extract, in file order.
+func annotRegions(fileName string, opts annotOptions) []*annotRegion {
+	reader, err := xopen.Ropen(fileName)
+	check(err)
+	features, err := annot.Read(reader, opts.format)
+	reader.Close()
+	check(err)
+
+	// Features that others belong to, such as mRNAs with exons, are wholes
+	// rather than parts, and are extracted as they are.
+	parents := make(map[string]bool)
+	if opts.stitch {
+		for _, f := range features {
+			if keys, ok := f.Attr(opts.groupBy); ok {
+				for _, key := range strings.Split(keys, ",") {
+					parents[key] = true
+				}
+			}
+		}
+	}
+
+	var regions []*annotRegion
+	groups := make(map[string]*annotRegion)
+	for _, f := range features {
+		if !opts.selected(f) {
+			continue
+		}
+		region := &annotRegion{name: opts.featureName(f), seq: f.Seq, strand: f.Strand, typ: f.Type,
+			parts: []annot.Block{{Start: f.Start, End: f.End}}}
+		if !opts.stitch {
+			regions = append(regions, region)
+			continue
+		}
+		if opts.format == annot.BED {
+			if len(f.Blocks) > 0 {
+				region.parts = f.Blocks
+			}
+			regions = append(regions, region)
+			continue
+		}
+		keys, ok := f.Attr(opts.groupBy)
+		if id, _ := f.Attr("ID"); !ok || (id != "" && parents[id]) {
+			// Not part of any group, e.g. a gene when stitching by Parent.
+			regions = append(regions, region)
+			continue
+		}
+		// A GFF3 feature may have several parents.
+		for _, key := range strings.Split(keys, ",") {
+			group, ok := groups[key]
+			if !ok {
+				group = &annotRegion{name: key, seq: f.Seq, strand: f.Strand, typ: f.Type}
+				groups[key] = group
+				regions = append(regions, group)
+			}
+			if group.seq != f.Seq || group.strand != f.Strand {
+				fmt.Fprintf(os.Stderr, "Error: Features of %s are on different sequences or strands.\n", key)
+				os.Exit(1)
+			}
+			group.parts = append(group.parts, region.parts...)
+		}
+	}
+	for key, region := range groups {
+		sort.Slice(region.parts, func(i, j int) bool { return region.parts[i].Start < region.parts[j].Start })
+		for i := 1; i < len(region.parts); i++ {
+			if region.parts[i].Start < region.parts[i-1].End {
+				fmt.Fprintf(os.Stderr, "Error: %s features of %s overlap, so they can't be stitched.\n", region.typ, key)
+				os.Exit(1)
+			}
+		}
+	}
+	return regions
+}
+
+// addFlanks extends the first and last parts of a region, clipped to the
+// sequence.
+func addFlanks(region *annotRegion, upstream, downstream, length int64) {
+	before, after := upstream, downstream
+	if region.strand == '-' {
+		before, after = downstream, upstream
+	}
+	first, last := &region.parts[0], &region.parts[len(region.parts)-1]
+	first.Start = max(first.Start-before, 0)
+	last.End = min(last.End+after, length)
+}
+
+// writeAnnotRegions extracts annotated regions, reverse complementing those on
+// the minus strand.
+func writeAnnotRegions(writer *xopen.Writer, r *faidx.Reader, regions []*annotRegion, opts annotOptions) {
+	missing := make(map[string]bool)
+	names := make(map[string]int)
+	for _, region := range regions {
+		rec, ok := r.Index.Lookup(region.seq)
+		if !ok {
+			if !missing[region.seq] {
+				fmt.Fprintf(os.Stderr, "Warning: Skipping features on %s, which is not in the sequence file.\n", region.seq)
+				missing[region.seq] = true
+			}
+			continue
+		}
+		addFlanks(region, opts.upstream, opts.downstream, rec.Length)
+
+		var s, q []byte
+		for _, p := range region.parts {
+			ps, pq, err := r.Fetch(region.seq, p.Start, p.End)
+			check(err)
+			s = append(s, ps...)
+			q = append(q, pq...)
+		}
+		strand := region.strand
+		if strand == '-' {
+			s = seqmath.ReverseComplement(s, seqmath.IsRNA(s))
+			seqmath.Reverse(q)
+		} else {
+			strand = '+'
+		}
+
+		location := region.location()
+		id := region.name
+		if id == "" {
+			id = location
+		}
+		names[id]++
+		if n := names[id]; n > 1 {
+			id = fmt.Sprintf("%s_%d", id, n)
+		}
+		name := fmt.Sprintf("%s region=%s strand=%c", id, location, strand)
+		if region.typ != "" {
+			name += " type=" + region.typ
+		}
+		var out *fastx.Record
+		var err error
+		if rec.QualOffset > 0 {
+			out, err = fastx.NewRecordWithQualWithoutValidation(seq.Unlimit, []byte(id), []byte(name), nil, s, q)
+		} else {
+			out, err = fastx.NewRecordWithoutValidation(seq.Unlimit, []byte(id), []byte(name), nil, s)
+		}
+		check(err)
+		out.FormatToWriter(writer, LineWrap)
+	}
+}
+
+// addRegionFlags adds the flags of commands extracting regions, shared by
+// subseq and faidx.
+func addRegionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("regions", "R", "", "Read regions from this file, one per line.")
+	cmd.Flags().BoolP("reverse-complement", "i", false, "Output the reverse complement of each region, with \"/rc\" appended to its name.")
+}
+
+// readRegionsFile reads one region per line, skipping blank lines and lines
+// starting with '#'.
+func readRegionsFile(fileName string) []string {
+	reader, err := xopen.Ropen(fileName)
+	check(err)
+	defer reader.Close()
+	var regions []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			regions = append(regions, line)
+		}
+	}
+	check(scanner.Err())
+	return regions
+}
+
+// writeRegions fetches regions from an indexed sequence file and writes them
+// as FASTA, or FASTQ if the file has qualities.
+func writeRegions(writer *xopen.Writer, cmd *cobra.Command, r *faidx.Reader, regionArgs []string) {
+	flags := cmd.Flags()
+	regionsFileName, err := flags.GetString("regions")
+	check(err)
+	if regionsFileName != "" {
+		regionArgs = append(regionArgs, readRegionsFile(regionsFileName)...)
+	}
+	revcomp, err := flags.GetBool("reverse-complement")
+	check(err)
+
+	// Parse all regions before writing anything.
+	regions := make([]faidx.Region, len(regionArgs))
+	for i, arg := range regionArgs {
+		if regions[i], err = faidx.ParseRegion(arg, r.Index); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, region := range regions {
+		s, q, err := r.Fetch(region.Name, region.Start, region.End)
+		check(err)
+		name := region.String()
+		if revcomp {
+			s = seqmath.ReverseComplement(s, seqmath.IsRNA(s))
+			seqmath.Reverse(q)
+			name += "/rc"
+		}
+		var rec *fastx.Record
+		if q != nil {
+			rec, err = fastx.NewRecordWithQualWithoutValidation(seq.Unlimit, []byte(name), []byte(name), nil, s, q)
+		} else {
+			rec, err = fastx.NewRecordWithoutValidation(seq.Unlimit, []byte(name), []byte(name), nil, s)
+		}
+		check(err)
+		rec.FormatToWriter(writer, LineWrap)
+	}
+}
+
+var subseqCmd = &cobra.Command{
+	Use:   "subseq SEQUENCE_FILE [REGION... | --bed/--gff/--gtf ANNOTATION_FILE]",
+	Short: "Extract regions from an indexed sequence file.",
+	Long: `
+
+subseq extracts regions of sequences, given as arguments or one per line in a
+--regions file, using the .fai index of the sequence file to read only the
+parts needed. The index is built (see catseq faidx) if it doesn't exist yet or
+is out of date.
+
+Regions are written as by samtools faidx: NAME for a whole sequence, or
+NAME:START-END with 1-based, inclusive coordinates, where END may be omitted
+and commas are allowed, e.g. chr7:55,000,001-55,200,000. Output records are
+named after their regions.
+
+With --bed, --gff or --gtf, the features of an annotation file are extracted
+instead (or as well). Features can be selected by type (--feature-type, e.g.
+CDS) and by attribute (--attr, e.g. --attr gene_biotype=protein_coding), and
+features on the minus strand are reverse complemented. With --stitch, the
+features of the one --feature-type given that share a transcript (--group-by,
+the Parent attribute for GFF3 or transcript_id for GTF) are joined in genomic
+order and then reverse complemented if on the minus strand, giving spliced
+transcripts from exons or coding sequences from CDS features; features of a
+transcript that overlap are an error. BED12 lines are stitched from their
+blocks. --flank, --upstream and --downstream add flanking bases, upstream and
+downstream being relative to the feature's strand; when stitching they are
+added to the ends of the transcript.
+
+Output records are named from the --name-attr attribute (by default ID or
+Name for GFF3, transcript_id or gene_id for GTF, the name column for BED, or
+the group when stitching), falling back to the location, with "_2", "_3"...
+appended to repeated names. Headers give the location of the extracted bases,
+e.g. "tx1 region=chr1:101-200,301-400 strand=- type=exon".
+
+FASTA and FASTQ files are supported, either uncompressed or compressed with
+bgzip (but not plain gzip), in which case a .gzi index is used as well. 2bit
+files need no separate index, and give soft-masked bases in lower case.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		if len(args) < 1 {
+			fmt.Fprintf(os.Stderr, "Error: No sequence file given.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		annotFileName, opts := getAnnotOptions(cmd)
+		regionsFileName, err := cmd.Flags().GetString("regions")
+		check(err)
+		if len(args) == 1 && regionsFileName == "" && annotFileName == "" {
+			fmt.Fprintf(os.Stderr, "Error: No regions given, as arguments or with --regions, --bed, --gff or --gtf.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+		r, err := faidx.Open(args[0])
+		check(err)
+		defer r.Close()
+		writer, err := xopen.Wopen("-") // "-" for STDOUT
+		check(err)
+		defer writer.Close()
+		if len(args) > 1 || regionsFileName != "" {
+			writeRegions(writer, cmd, r, args[1:])
+		}
+		if annotFileName != "" {
+			writeAnnotRegions(writer, r, annotRegions(annotFileName, opts), opts)
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/eernst/catseq/digest"
+	"github.com/eernst/catseq/seqfile"
+	"github.com/eernst/catseq/seqmath"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(sumCmd)
+	sumCmd.Flags().BoolP("per-record", "r", false, "Print the digests of each record instead of each file.")
+	sumCmd.Flags().BoolP("ignore-names", "n", false, "Leave record names out of file digests.")
+	sumCmd.Flags().BoolP("ignore-case", "i", false, "Ignore the case of bases, e.g. soft-masking, in file digests.")
+	sumCmd.Flags().BoolP("ignore-strand", "s", false, "Digest each sequence or its reverse complement, whichever sorts first.")
+}
+
+// canonicalStrand returns s or its reverse complement, whichever sorts first
+// ignoring case.
+func canonicalStrand(s []byte) []byte {
+	rc := seqmath.ReverseComplement(s, seqmath.IsRNA(s))
+	if bytes.Compare(bytes.ToUpper(rc), bytes.ToUpper(s)) < 0 {
+		return rc
+	}
+	return s
+}
+
+var sumCmd = &cobra.Command{
+	Use:   "sum [SEQUENCE_FILE...]",
+	Short: "Compute checksums of sequences and (multi-)sequence files.",
+	Long: `
+
+sum computes digests of sequence content, e.g. to check that copies of a
+reference on different servers are identical however their FASTA lines are
+wrapped. For each input file it prints the columns "file", "records", "bases"
+and "digest", where the digest covers the ID and sequence of each record in
+order, but not descriptions, line wrapping or the format of the file.
+
+With --per-record, it instead prints for each record the columns "name",
+"length", "md5" and "refget":
+
+  md5     the MD5 digest used in the M5 tag of SAM @SQ lines, of the sequence
+          upper-cased
+  refget  the GA4GH refget identifier, "SQ." followed by the sha512t24u
+          digest (the base64url-encoded first 24 bytes of the SHA-512 digest)
+          of the sequence upper-cased
+
+File digests can be made to ignore record names (--ignore-names), e.g. to
+compare references whose header lines differ, and the case of bases
+(--ignore-case), e.g. to compare references masked differently. With
+--ignore-strand, each sequence is digested as it is or reverse complemented,
+whichever comes first alphabetically, in file and record digests alike, so
+that records differing only in orientation match; record digests then no
+longer match M5 tags and refget identifiers for the other orientation.
+
+Column names are printed given --print-header.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		flags := cmd.Flags()
+		perRecord, err := flags.GetBool("per-record")
+		check(err)
+		ignoreNames, err := flags.GetBool("ignore-names")
+		check(err)
+		ignoreCase, err := flags.GetBool("ignore-case")
+		check(err)
+		ignoreStrand, err := flags.GetBool("ignore-strand")
+		check(err)
+
+		seqsInFileNames := args
+		if len(seqsInFileNames) == 0 {
+			seqsInFileNames = []string{"-"}
+			fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
+		}
+
+		writer, err := xopen.Wopen("-") // "-" for STDOUT
+		check(err)
+		defer writer.Close()
+		if PrintHeader {
+			if perRecord {
+				fmt.Fprintf(writer, "name\tlength\tmd5\trefget\n")
+			} else {
+				fmt.Fprintf(writer, "file\trecords\tbases\tdigest\n")
+			}
+		}
+
+		seq.ValidateSeq = false
+		for _, fileName := range seqsInFileNames {
+			reader, err := seqfile.NewReader(fileName, "")
+			check(err)
+			agg := digest.NewAggregate()
+			var records, bases int64
+			for {
+				rec, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				check(err)
+				s := rec.Seq.Seq
+				if ignoreStrand {
+					s = canonicalStrand(s)
+				}
+				records++
+				bases += int64(len(s))
+				if perRecord {
+					fmt.Fprintf(writer, "%s\t%d\t%s\t%s\n", rec.ID, len(s), digest.MD5(s), digest.Refget(s))
+					continue
+				}
+				var name []byte
+				if !ignoreNames {
+					name = rec.ID
+				}
+				if ignoreCase {
+					s = bytes.ToUpper(s)
+				}
+				agg.Add(name, s)
+			}
+			reader.Close()
+			if !perRecord {
+				fmt.Fprintf(writer, "%s\t%d\t%d\t%s\n", fileName, records, bases, agg.Sum())
+			}
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
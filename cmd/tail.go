@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(tailCmd)
+	tailCmd.Flags().IntP("lines", "n", 10, "Number of records to output.")
+}
+
+var tailCmd = &cobra.Command{
+	Use:   "tail [SEQUENCE_FILE]",
+	Short: "Output the last records of (multi-)sequence files.",
+	Long: `
+
+tail outputs the last N records (not lines), for both FASTA and FASTQ. Only N
+records are held in memory at a time.
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		n, err := cmd.Flags().GetInt("lines")
+		check(err)
+		if n > 0 {
+			runSlice(cmd, args, -n, -1)
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eernst/catseq/seqfile"
+	"github.com/eernst/catseq/seqmath"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(translateCmd)
+	translateCmd.Flags().IntP("table", "T", 1, "NCBI genetic code (translation table) to use. See --list-tables.")
+	translateCmd.Flags().BoolP("list-tables", "", false, "List the available genetic codes and exit.")
+	translateCmd.Flags().StringP("frame", "f", "1", "Frames to translate: a comma-separated list of 1, 2, 3, -1, -2, -3, or 6 for all six.")
+	translateCmd.Flags().BoolP("trim", "", false, "Remove stops ('*') from the end of each translation.")
+	translateCmd.Flags().IntP("min-orf", "m", 0, "Output open reading frames of at least this many amino acids instead of whole translations.")
+	translateCmd.Flags().BoolP("alt-starts", "", false, "Let ORFs begin with any start codon of the genetic code rather than only ATG.")
+	translateCmd.Flags().BoolP("partial", "", false, "Also output ORFs that run off the end of the sequence without a stop codon.")
+}
+
+// parseFrames parses --frame.
+func parseFrames(s string) ([]int, error) {
+	if s == "6" {
+		return seqmath.Frames, nil
+	}
+	var frames []int
+	seen := make(map[int]bool)
+	for _, f := range strings.Split(s, ",") {
+		frame, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || frame < -3 || frame > 3 || frame == 0 {
+			return nil, fmt.Errorf("bad frame %q: use 1, 2, 3, -1, -2, -3, or 6 for all six", f)
+		}
+		if !seen[frame] {
+			seen[frame] = true
+			frames = append(frames, frame)
+		}
+	}
+	return frames, nil
+}
+
+// frameAttrs formats the header attributes locating a translation, with
+// 1-based, inclusive plus strand coordinates.
+func frameAttrs(frame, start, end int) string {
+	strand := '+'
+	if frame < 0 {
+		strand = '-'
+	}
+	return fmt.Sprintf(" frame=%+d strand=%c start=%d end=%d", frame, strand, start+1, end)
+}
+
+func writeProtein(writer *xopen.Writer, id, name string, protein []byte) {
+	rec, err := fastx.NewRecordWithoutValidation(seq.Protein, []byte(id), []byte(name), nil, protein)
+	check(err)
+	rec.FormatToWriter(writer, LineWrap)
+}
+
+var translateCmd = &cobra.Command{
+	Use:   "translate [SEQUENCE_FILE]",
+	Short: "Translate nucleotide sequences to protein, or find open reading frames.",
+	Long: `
+
+translate outputs the protein translation of each input sequence as FASTA,
+using any of the NCBI genetic codes (--table, listed by --list-tables).
+
+By default frame 1 is translated. --frame selects other frames, -1 to -3 being
+read from the reverse complement, or all six with --frame 6. With more than
+one frame, IDs are suffixed with the frame, e.g. "contig1_-2". Stop codons are
+translated as '*', and codons with ambiguous bases as 'X' unless all the codons
+they stand for give the same amino acid. --trim removes stops from the end of
+each translation.
+
+Headers locate each translation on the plus strand with 1-based, inclusive
+coordinates, e.g. "contig1_-2 frame=-2 strand=- start=3 end=302".
+
+With --min-orf N, open reading frames of at least N amino acids (excluding the
+stop) are output instead. An ORF runs from a start codon, ATG or with
+--alt-starts any start codon of the genetic code (translated as M), to the
+next stop codon in frame; nested start codons do not give ORFs of their own.
+ORFs are numbered within each sequence, e.g. "contig1_orf3", and their
+coordinates include the stop codon. ORFs lacking a stop because they reach
+the end of the sequence are only output with --partial, marked "partial=yes".
+
+` + seqFormatsHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		StartProfiling()
+
+		flags := cmd.Flags()
+		listTables, err := flags.GetBool("list-tables")
+		check(err)
+		if listTables {
+			for _, t := range seqmath.GeneticCodes() {
+				fmt.Printf("%d\t%s\n", t.ID, strings.TrimSpace(t.Name))
+			}
+			return
+		}
+
+		tableID, err := flags.GetInt("table")
+		check(err)
+		table, err := seqmath.GeneticCode(tableID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v. See --list-tables.\n", err)
+			os.Exit(1)
+		}
+		frameFlag, err := flags.GetString("frame")
+		check(err)
+		frames, err := parseFrames(frameFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		trim, err := flags.GetBool("trim")
+		check(err)
+		var orfOpts seqmath.ORFOptions
+		orfOpts.MinLength, err = flags.GetInt("min-orf")
+		check(err)
+		orfOpts.AltStarts, err = flags.GetBool("alt-starts")
+		check(err)
+		orfOpts.Partial, err = flags.GetBool("partial")
+		check(err)
+		findORFs := orfOpts.MinLength > 0
+		if !findORFs && (orfOpts.AltStarts || orfOpts.Partial) {
+			fmt.Fprintf(os.Stderr, "Error: --alt-starts and --partial only apply to ORFs, requested with --min-orf.\n")
+			os.Exit(1)
+		}
+
+		var seqsInFileName string
+		switch len(args) {
+		case 0:
+			seqsInFileName = "-"
+			fmt.Fprintf(os.Stderr, "No input sequence file given. Reading from STDIN.\n")
+		case 1:
+			seqsInFileName = args[0]
+		default:
+			fmt.Fprintf(os.Stderr, "Error: Wrong number of positional arguments given.\n")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		seq.ValidateSeq = false
+		reader, err := seqfile.NewReader(seqsInFileName, "")
+		check(err)
+		defer reader.Close()
+
+		writer, err := xopen.Wopen("-") // "-" for STDOUT
+		check(err)
+		defer writer.Close()
+
+		for {
+			rec, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			check(err)
+			id := string(rec.ID)
+
+			if findORFs {
+				n := 0
+				for _, frame := range frames {
+					orfs, err := seqmath.FindORFs(table, rec.Seq.Seq, frame, orfOpts)
+					check(err)
+					for _, orf := range orfs {
+						n++
+						orfID := fmt.Sprintf("%s_orf%d", id, n)
+						name := orfID + frameAttrs(frame, orf.Start, orf.End) + fmt.Sprintf(" aa=%d", len(orf.Protein))
+						if !orf.Complete {
+							name += " partial=yes"
+						}
+						writeProtein(writer, orfID, name, orf.Protein)
+					}
+				}
+				continue
+			}
+
+			for _, frame := range frames {
+				protein, start, end, err := seqmath.TranslateFrame(table, rec.Seq.Seq, frame)
+				check(err)
+				if trim {
+					protein = bytes.TrimRight(protein, "*")
+				}
+				frameID := id
+				if len(frames) > 1 {
+					frameID = fmt.Sprintf("%s_%+d", id, frame)
+				}
+				writeProtein(writer, frameID, frameID+frameAttrs(frame, start, end), protein)
+			}
+		}
+
+		time.Sleep(0 * time.Millisecond)
+
+		StopProfiling()
+	},
+}
@@ -0,0 +1,73 @@
+package digest
+
+import (
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+)
+
+// normalize returns the printable characters of s, upper-cased, as digested
+// for SAM M5 tags and refget identifiers.
+func normalize(s []byte) []byte {
+	out := make([]byte, 0, len(s))
+	for _, c := range s {
+		if c < '!' || c > '~' {
+			continue
+		}
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// MD5 returns the hex MD5 digest of a sequence as given in the M5 tag of SAM
+// @SQ header lines, which is of its printable characters, upper-cased.
+func MD5(s []byte) string {
+	sum := md5.Sum(normalize(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// SHA512t24u returns the GA4GH sha512t24u digest of b: the base64url encoding,
+// without padding, of the first 24 bytes of its SHA-512 digest.
+func SHA512t24u(b []byte) string {
+	sum := sha512.Sum512(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:24])
+}
+
+// Refget returns the GA4GH refget identifier of a sequence: "SQ." followed by
+// the sha512t24u digest of its printable characters, upper-cased.
+func Refget(s []byte) string {
+	return "SQ." + SHA512t24u(normalize(s))
+}
+
+// Aggregate digests a whole file from its records, independently of how
+// their sequences were wrapped. Each record adds its name, if any, and the
+// sha512t24u digest of its sequence, so records must be added in order.
+type Aggregate struct {
+	h hash.Hash
+}
+
+// NewAggregate returns an empty Aggregate.
+func NewAggregate() *Aggregate {
+	return &Aggregate{h: sha512.New()}
+}
+
+// Add adds a record. name may be nil to leave names out of the digest.
+func (a *Aggregate) Add(name, s []byte) {
+	if name != nil {
+		a.h.Write(name)
+		a.h.Write([]byte{'\t'})
+	}
+	a.h.Write([]byte(SHA512t24u(s)))
+	a.h.Write([]byte{'\n'})
+}
+
+// Sum returns the digest of the records added so far, in the sha512t24u
+// encoding.
+func (a *Aggregate) Sum() string {
+	return base64.RawURLEncoding.EncodeToString(a.h.Sum(nil)[:24])
+}
@@ -0,0 +1,165 @@
+// Package expr implements the small boolean expression language used to
+// select sequence records, e.g.
+//
+//	len >= 1000 && meanq > 12 && gc < 0.6 || name =~ "chrM"
+//
+// An expression is compiled once against a fixed table of variables and can
+// then be evaluated concurrently from any number of goroutines.
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Type is the static type of a variable or sub-expression.
+type Type int
+
+const (
+	Number Type = iota
+	String
+	Bool
+)
+
+func (t Type) String() string {
+	switch t {
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Bool:
+		return "boolean"
+	}
+	return "unknown"
+}
+
+// Var describes a variable that expressions may refer to. Its position in the
+// slice given to Compile is the index passed back to the Env.
+type Var struct {
+	Name string
+	Type Type
+	Help string
+}
+
+// Env supplies variable values for a single evaluation.
+type Env interface {
+	// Number returns the value of the numeric variable at index i.
+	Number(i int) float64
+	// String returns the value of the string variable at index i.
+	String(i int) string
+	// Attr looks up a key=value attribute, used by the attr() and has()
+	// functions.
+	Attr(key string) (string, bool)
+}
+
+// Program is a compiled expression. It is safe for concurrent use.
+type Program struct {
+	src  string
+	eval func(Env) bool
+}
+
+// Eval reports whether the expression holds for env.
+func (p *Program) Eval(env Env) bool {
+	return p.eval(env)
+}
+
+func (p *Program) String() string {
+	return p.src
+}
+
+// SyntaxError describes a problem with an expression and where it occurred.
+type SyntaxError struct {
+	Src string
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid expression at column %d: %s\n    %s\n    %s^",
+		e.Pos+1, e.Msg, e.Src, strings.Repeat(" ", e.Pos))
+}
+
+// Compile parses src and type checks it against vars.
+func Compile(src string, vars []Var) (*Program, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 1 {
+		return nil, &SyntaxError{Src: src, Pos: 0, Msg: "empty expression"}
+	}
+	p := &parser{src: src, toks: toks, vars: make(map[string]int, len(vars)), varDefs: vars}
+	for i, v := range vars {
+		p.vars[v.Name] = i
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok.pos, "unexpected %v after complete expression (missing operator?)", tok)
+	}
+	if root.typ != Bool {
+		return nil, p.errorf(root.pos, "expression must be true/false, but evaluates to a %v (missing comparison?)", root.typ)
+	}
+	return &Program{src: src, eval: root.b}, nil
+}
+
+// Usage returns a human readable listing of vars and the built-in functions
+// for inclusion in command help.
+func Usage(vars []Var) string {
+	var sb strings.Builder
+	sb.WriteString("Variables:\n")
+	for _, v := range vars {
+		fmt.Fprintf(&sb, "  %-10s %-7s %s\n", v.Name, v.Type, v.Help)
+	}
+	sb.WriteString("\nFunctions:\n")
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := functions[name]
+		args := make([]string, len(f.args))
+		for i, a := range f.args {
+			args[i] = a.String()
+		}
+		fmt.Fprintf(&sb, "  %-24s %s\n", name+"("+strings.Join(args, ", ")+")", f.help)
+	}
+	sb.WriteString("\nOperators: || && ! == != < <= > >= =~ !~ + - * / % (and, or, not also accepted)\n")
+	return sb.String()
+}
+
+// closest returns the candidate with the smallest edit distance to name, if
+// it is close enough to be a plausible typo.
+func closest(name string, candidates []string) string {
+	best, bestDist := "", len(name)/2+1
+	for _, c := range candidates {
+		if d := editDistance(name, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,187 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	pos  int // byte offset into the source
+	text string
+	num  float64
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// Operators are matched longest first.
+var operators = []string{
+	"&&", "||", "==", "!=", "<=", ">=", "=~", "!~",
+	"<", ">", "!", "+", "-", "*", "/", "%",
+}
+
+// Word forms of the logical operators.
+var wordOperators = map[string]string{
+	"and": "&&",
+	"or":  "||",
+	"not": "!",
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, pos: i, text: "("})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, pos: i, text: ")"})
+			i++
+		case c == ',':
+			toks = append(toks, token{kind: tokComma, pos: i, text: ","})
+			i++
+		case c == '"' || c == '\'':
+			s, n, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tokString, pos: i, text: s})
+			i += n
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i
+			for j < len(src) && (isDigit(src[j]) || src[j] == '.') {
+				j++
+			}
+			if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+				k := j + 1
+				if k < len(src) && (src[k] == '+' || src[k] == '-') {
+					k++
+				}
+				if k < len(src) && isDigit(src[k]) {
+					j = k
+					for j < len(src) && isDigit(src[j]) {
+						j++
+					}
+				}
+			}
+			if j < len(src) && isIdentChar(src[j]) {
+				return nil, &SyntaxError{Src: src, Pos: i, Msg: fmt.Sprintf("malformed number %q", src[i:j+1])}
+			}
+			v, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, &SyntaxError{Src: src, Pos: i, Msg: fmt.Sprintf("malformed number %q", src[i:j])}
+			}
+			toks = append(toks, token{kind: tokNumber, pos: i, text: src[i:j], num: v})
+			i = j
+		case isIdentStart(c):
+			j := i
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			word := src[i:j]
+			if op, ok := wordOperators[strings.ToLower(word)]; ok {
+				toks = append(toks, token{kind: tokOp, pos: i, text: op})
+			} else {
+				toks = append(toks, token{kind: tokIdent, pos: i, text: word})
+			}
+			i = j
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, token{kind: tokOp, pos: i, text: op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				msg := fmt.Sprintf("unexpected character %q", rune(c))
+				switch c {
+				case '&':
+					msg += " (did you mean \"&&\"?)"
+				case '|':
+					msg += " (did you mean \"||\"?)"
+				case '=':
+					msg += " (did you mean \"==\" or \"=~\"?)"
+				}
+				return nil, &SyntaxError{Src: src, Pos: i, Msg: msg}
+			}
+		}
+	}
+	toks = append(toks, token{kind: tokEOF, pos: len(src)})
+	return toks, nil
+}
+
+// lexString reads a single or double quoted string starting at src[start],
+// returning the unquoted value and the number of bytes consumed.
+func lexString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var sb strings.Builder
+	i := start + 1
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == quote:
+			return sb.String(), i + 1 - start, nil
+		case c == '\\' && i+1 < len(src):
+			next := src[i+1]
+			switch next {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case '\\', '"', '\'':
+				sb.WriteByte(next)
+			default:
+				// Keep unknown escapes intact so regex escapes like \d survive.
+				sb.WriteByte('\\')
+				sb.WriteByte(next)
+			}
+			i += 2
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, &SyntaxError{Src: src, Pos: start, Msg: "unterminated string"}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c))
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
@@ -0,0 +1,452 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// operand is a compiled, typed sub-expression. Exactly one of n, s or b is
+// set, according to typ.
+type operand struct {
+	typ Type
+	pos int
+	n   func(Env) float64
+	s   func(Env) string
+	b   func(Env) bool
+	lit *string // non-nil for string literals
+}
+
+type parser struct {
+	src     string
+	toks    []token
+	i       int
+	vars    map[string]int
+	varDefs []Var
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{Src: p.src, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) expectType(o *operand, t Type, what string) error {
+	if o.typ != t {
+		return p.errorf(o.pos, "%s must be a %v, got a %v", what, t, o.typ)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (*operand, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectType(left, Bool, "left operand of ||"); err != nil {
+			return nil, err
+		}
+		if err := p.expectType(right, Bool, "right operand of ||"); err != nil {
+			return nil, err
+		}
+		l, r := left.b, right.b
+		left = &operand{typ: Bool, pos: op.pos, b: func(e Env) bool { return l(e) || r(e) }}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (*operand, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		op := p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectType(left, Bool, "left operand of &&"); err != nil {
+			return nil, err
+		}
+		if err := p.expectType(right, Bool, "right operand of &&"); err != nil {
+			return nil, err
+		}
+		l, r := left.b, right.b
+		left = &operand{typ: Bool, pos: op.pos, b: func(e Env) bool { return l(e) && r(e) }}
+	}
+	return left, nil
+}
+
+func (p *parser) parseComparison() (*operand, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("==", "!=", "<", "<=", ">", ">=", "=~", "!~") {
+		return left, nil
+	}
+	op := p.next()
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("==", "!=", "<", "<=", ">", ">=", "=~", "!~") {
+		return nil, p.errorf(p.peek().pos, "comparisons cannot be chained; combine them with &&")
+	}
+
+	if op.text == "=~" || op.text == "!~" {
+		if err := p.expectType(left, String, "left operand of "+op.text); err != nil {
+			return nil, err
+		}
+		if right.lit == nil {
+			return nil, p.errorf(right.pos, "right operand of %s must be a quoted regular expression", op.text)
+		}
+		re, err := regexp.Compile(*right.lit)
+		if err != nil {
+			return nil, p.errorf(right.pos, "bad regular expression: %v", err)
+		}
+		l, negate := left.s, op.text == "!~"
+		return &operand{typ: Bool, pos: op.pos, b: func(e Env) bool { return re.MatchString(l(e)) != negate }}, nil
+	}
+
+	if left.typ != right.typ {
+		return nil, p.errorf(op.pos, "cannot compare %v with %v using %s", left.typ, right.typ, op.text)
+	}
+	var cmp func(Env) int
+	switch left.typ {
+	case Number:
+		l, r := left.n, right.n
+		cmp = func(e Env) int {
+			a, b := l(e), r(e)
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			case a == b:
+				return 0
+			}
+			return 2 // NaN compares false to everything
+		}
+	case String:
+		l, r := left.s, right.s
+		cmp = func(e Env) int { return strings.Compare(l(e), r(e)) }
+	case Bool:
+		if op.text != "==" && op.text != "!=" {
+			return nil, p.errorf(op.pos, "booleans can only be compared with == or !=")
+		}
+		l, r := left.b, right.b
+		cmp = func(e Env) int {
+			if l(e) == r(e) {
+				return 0
+			}
+			return 1
+		}
+	}
+
+	var test func(int) bool
+	switch op.text {
+	case "==":
+		test = func(c int) bool { return c == 0 }
+	case "!=":
+		test = func(c int) bool { return c != 0 }
+	case "<":
+		test = func(c int) bool { return c == -1 }
+	case "<=":
+		test = func(c int) bool { return c == -1 || c == 0 }
+	case ">":
+		test = func(c int) bool { return c == 1 }
+	case ">=":
+		test = func(c int) bool { return c == 1 || c == 0 }
+	}
+	return &operand{typ: Bool, pos: op.pos, b: func(e Env) bool { return test(cmp(e)) }}, nil
+}
+
+func (p *parser) parseAdditive() (*operand, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+", "-") {
+		op := p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.arith(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (*operand, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*", "/", "%") {
+		op := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.arith(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) arith(op token, left, right *operand) (*operand, error) {
+	if err := p.expectType(left, Number, "left operand of "+op.text); err != nil {
+		return nil, err
+	}
+	if err := p.expectType(right, Number, "right operand of "+op.text); err != nil {
+		return nil, err
+	}
+	l, r := left.n, right.n
+	var f func(Env) float64
+	switch op.text {
+	case "+":
+		f = func(e Env) float64 { return l(e) + r(e) }
+	case "-":
+		f = func(e Env) float64 { return l(e) - r(e) }
+	case "*":
+		f = func(e Env) float64 { return l(e) * r(e) }
+	case "/":
+		f = func(e Env) float64 { return l(e) / r(e) }
+	case "%":
+		f = func(e Env) float64 { return math.Mod(l(e), r(e)) }
+	}
+	return &operand{typ: Number, pos: left.pos, n: f}, nil
+}
+
+func (p *parser) parseUnary() (*operand, error) {
+	switch {
+	case p.isOp("!"):
+		op := p.next()
+		o, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectType(o, Bool, "operand of !"); err != nil {
+			return nil, err
+		}
+		b := o.b
+		return &operand{typ: Bool, pos: op.pos, b: func(e Env) bool { return !b(e) }}, nil
+	case p.isOp("-"):
+		op := p.next()
+		o, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectType(o, Number, "operand of unary -"); err != nil {
+			return nil, err
+		}
+		n := o.n
+		return &operand{typ: Number, pos: op.pos, n: func(e Env) float64 { return -n(e) }}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (*operand, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		v := tok.num
+		return &operand{typ: Number, pos: tok.pos, n: func(Env) float64 { return v }}, nil
+	case tokString:
+		v := tok.text
+		return &operand{typ: String, pos: tok.pos, s: func(Env) string { return v }, lit: &v}, nil
+	case tokLParen:
+		o, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, p.errorf(p.peek().pos, "expected \")\" to close \"(\" at column %d, found %v", tok.pos+1, p.peek())
+		}
+		p.next()
+		o.lit = nil
+		return o, nil
+	case tokIdent:
+		if p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		return p.variable(tok)
+	case tokEOF:
+		return nil, p.errorf(tok.pos, "unexpected end of expression, expected a value")
+	}
+	return nil, p.errorf(tok.pos, "expected a value, found %v", tok)
+}
+
+func (p *parser) variable(tok token) (*operand, error) {
+	switch tok.text {
+	case "true", "false":
+		v := tok.text == "true"
+		return &operand{typ: Bool, pos: tok.pos, b: func(Env) bool { return v }}, nil
+	}
+	idx, ok := p.vars[tok.text]
+	if !ok {
+		names := make([]string, 0, len(p.varDefs))
+		for _, v := range p.varDefs {
+			names = append(names, v.Name)
+		}
+		if _, isFunc := functions[tok.text]; isFunc {
+			return nil, p.errorf(tok.pos, "%s is a function; call it as %s(...)", tok.text, tok.text)
+		}
+		if guess := closest(tok.text, names); guess != "" {
+			return nil, p.errorf(tok.pos, "unknown variable %q (did you mean %q?)", tok.text, guess)
+		}
+		return nil, p.errorf(tok.pos, "unknown variable %q; known variables are %s (use attr(\"key\") for header attributes)",
+			tok.text, strings.Join(names, ", "))
+	}
+	switch p.varDefs[idx].Type {
+	case Number:
+		return &operand{typ: Number, pos: tok.pos, n: func(e Env) float64 { return e.Number(idx) }}, nil
+	case String:
+		return &operand{typ: String, pos: tok.pos, s: func(e Env) string { return e.String(idx) }}, nil
+	}
+	return nil, p.errorf(tok.pos, "variable %q has unsupported type %v", tok.text, p.varDefs[idx].Type)
+}
+
+type function struct {
+	args []Type
+	ret  Type
+	help string
+	// build returns the compiled call given compiled arguments.
+	build func(args []*operand) *operand
+}
+
+var functions = map[string]function{
+	"attr": {args: []Type{String}, ret: String, help: "value of header attribute key=value, or \"\"",
+		build: func(a []*operand) *operand {
+			k := a[0].s
+			return &operand{s: func(e Env) string { v, _ := e.Attr(k(e)); return v }}
+		}},
+	"has": {args: []Type{String}, ret: Bool, help: "whether the header has the attribute",
+		build: func(a []*operand) *operand {
+			k := a[0].s
+			return &operand{b: func(e Env) bool { _, ok := e.Attr(k(e)); return ok }}
+		}},
+	"num": {args: []Type{String}, ret: Number, help: "string converted to a number (NaN if not numeric)",
+		build: func(a []*operand) *operand {
+			s := a[0].s
+			return &operand{n: func(e Env) float64 {
+				v, err := strconv.ParseFloat(strings.TrimSpace(s(e)), 64)
+				if err != nil {
+					return math.NaN()
+				}
+				return v
+			}}
+		}},
+	"contains": {args: []Type{String, String}, ret: Bool, help: "whether the first string contains the second",
+		build: func(a []*operand) *operand {
+			s, sub := a[0].s, a[1].s
+			return &operand{b: func(e Env) bool { return strings.Contains(s(e), sub(e)) }}
+		}},
+	"lower": {args: []Type{String}, ret: String, help: "lower-cased string",
+		build: func(a []*operand) *operand {
+			s := a[0].s
+			return &operand{s: func(e Env) string { return strings.ToLower(s(e)) }}
+		}},
+	"abs": {args: []Type{Number}, ret: Number, help: "absolute value",
+		build: func(a []*operand) *operand {
+			x := a[0].n
+			return &operand{n: func(e Env) float64 { return math.Abs(x(e)) }}
+		}},
+	"log10": {args: []Type{Number}, ret: Number, help: "base 10 logarithm",
+		build: func(a []*operand) *operand {
+			x := a[0].n
+			return &operand{n: func(e Env) float64 { return math.Log10(x(e)) }}
+		}},
+	"min": {args: []Type{Number, Number}, ret: Number, help: "smaller of two numbers",
+		build: func(a []*operand) *operand {
+			x, y := a[0].n, a[1].n
+			return &operand{n: func(e Env) float64 { return math.Min(x(e), y(e)) }}
+		}},
+	"max": {args: []Type{Number, Number}, ret: Number, help: "larger of two numbers",
+		build: func(a []*operand) *operand {
+			x, y := a[0].n, a[1].n
+			return &operand{n: func(e Env) float64 { return math.Max(x(e), y(e)) }}
+		}},
+}
+
+func (p *parser) parseCall(name token) (*operand, error) {
+	f, ok := functions[name.text]
+	if !ok {
+		names := make([]string, 0, len(functions))
+		for n := range functions {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if guess := closest(name.text, names); guess != "" {
+			return nil, p.errorf(name.pos, "unknown function %q (did you mean %q?)", name.text, guess)
+		}
+		return nil, p.errorf(name.pos, "unknown function %q; known functions are %s", name.text, strings.Join(names, ", "))
+	}
+	p.next() // (
+	var args []*operand
+	if p.peek().kind != tokRParen {
+		for {
+			a, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, a)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.peek().kind != tokRParen {
+		return nil, p.errorf(p.peek().pos, "expected \",\" or \")\" in call to %s, found %v", name.text, p.peek())
+	}
+	p.next()
+	if len(args) != len(f.args) {
+		return nil, p.errorf(name.pos, "%s takes %d argument(s), got %d", name.text, len(f.args), len(args))
+	}
+	for i, a := range args {
+		if err := p.expectType(a, f.args[i], fmt.Sprintf("argument %d of %s", i+1, name.text)); err != nil {
+			return nil, err
+		}
+	}
+	o := f.build(args)
+	o.typ, o.pos = f.ret, name.pos
+	return o, nil
+}
@@ -0,0 +1,171 @@
+package faidx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Build indexes the FASTA or FASTQ data read from r. As with samtools faidx,
+// all lines of a sequence but the last must have the same length.
+func Build(r io.Reader) (*Index, error) {
+	lr := &lineReader{r: bufio.NewReaderSize(r, 1<<16)}
+	idx := newIndex()
+	first, err := lr.next()
+	for err == nil && first.length == 0 {
+		first, err = lr.next()
+	}
+	if err == io.EOF {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch first.head[0] {
+	case '>':
+		err = buildFasta(idx, lr, first)
+	case '@':
+		err = buildFastq(idx, lr, first)
+	default:
+		err = fmt.Errorf("faidx: not in FASTA or FASTQ format")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// headerName returns the sequence name of a header line: the text after the
+// '>' or '@' up to the first whitespace.
+func headerName(l line) string {
+	name := l.head[1:]
+	if i := bytes.IndexAny(name, " \t"); i >= 0 {
+		name = name[:i]
+	}
+	return string(name)
+}
+
+// lineLayout checks that the lines of a sequence (or its qualities) have the
+// same length, except the last.
+type lineLayout struct {
+	name      string
+	bases     int64 // bases per line
+	width     int64 // bytes per line
+	length    int64 // total bases
+	truncated bool  // a short (last) line has been seen
+}
+
+func (ll *lineLayout) add(l line) error {
+	if l.length == 0 {
+		ll.truncated = true
+		return nil
+	}
+	if ll.truncated {
+		return fmt.Errorf("faidx: different line length in sequence %q", ll.name)
+	}
+	noTerminator := l.width == l.length // only possible on the last line
+	switch {
+	case ll.bases == 0:
+		ll.bases, ll.width = l.length, l.width
+		if noTerminator {
+			ll.width++
+		}
+	case l.length > ll.bases:
+		return fmt.Errorf("faidx: different line length in sequence %q", ll.name)
+	case l.length < ll.bases || noTerminator:
+		ll.truncated = true
+	case l.width != ll.width:
+		return fmt.Errorf("faidx: different line terminators in sequence %q", ll.name)
+	}
+	ll.length += l.length
+	return nil
+}
+
+func buildFasta(idx *Index, lr *lineReader, header line) error {
+	for {
+		rec := Record{Name: headerName(header), Offset: header.start + header.width}
+		layout := lineLayout{name: rec.Name}
+		var l line
+		var err error
+		for {
+			if l, err = lr.next(); err != nil {
+				break
+			}
+			if l.length > 0 && l.head[0] == '>' {
+				break
+			}
+			if err := layout.add(l); err != nil {
+				return err
+			}
+		}
+		rec.Length, rec.LineBases, rec.LineWidth = layout.length, layout.bases, layout.width
+		if err := idx.add(rec); err != nil {
+			return err
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		header = l
+	}
+}
+
+func buildFastq(idx *Index, lr *lineReader, header line) error {
+	for {
+		if header.head[0] != '@' {
+			return fmt.Errorf("faidx: expected a FASTQ header at offset %d", header.start)
+		}
+		rec := Record{Name: headerName(header), Offset: header.start + header.width}
+		seqLayout := lineLayout{name: rec.Name}
+		for {
+			l, err := lr.next()
+			if err == io.EOF {
+				return fmt.Errorf("faidx: truncated FASTQ record %q", rec.Name)
+			}
+			if err != nil {
+				return err
+			}
+			if l.length > 0 && l.head[0] == '+' {
+				rec.QualOffset = l.start + l.width
+				break
+			}
+			if err := seqLayout.add(l); err != nil {
+				return err
+			}
+		}
+		rec.Length, rec.LineBases, rec.LineWidth = seqLayout.length, seqLayout.bases, seqLayout.width
+
+		qualLayout := lineLayout{name: rec.Name}
+		for qualLayout.length < rec.Length {
+			l, err := lr.next()
+			if err == io.EOF {
+				return fmt.Errorf("faidx: truncated FASTQ record %q", rec.Name)
+			}
+			if err != nil {
+				return err
+			}
+			if err := qualLayout.add(l); err != nil {
+				return err
+			}
+		}
+		if qualLayout.length != rec.Length || (rec.Length > 0 && qualLayout.bases != rec.LineBases) {
+			return fmt.Errorf("faidx: sequence and quality of %q are laid out differently", rec.Name)
+		}
+		if err := idx.add(rec); err != nil {
+			return err
+		}
+
+		var err error
+		for header, err = lr.next(); err == nil && header.length == 0; header, err = lr.next() {
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
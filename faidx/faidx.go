@@ -0,0 +1,175 @@
+// Package faidx reads and writes samtools-compatible .fai indexes of FASTA
+// and FASTQ files, and uses them to fetch subsequences without reading whole
+// files. Files compressed with bgzip are supported through their .gzi index,
+// and 2bit files through the index they start with.
+package faidx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Record is one line of a .fai index. Offsets are in bytes from the start of
+// the (uncompressed) file.
+type Record struct {
+	Name       string
+	Length     int64 // number of bases
+	Offset     int64 // of the first base
+	LineBases  int64 // bases per line
+	LineWidth  int64 // bytes per line, including the line terminator
+	QualOffset int64 // of the first quality, for FASTQ; 0 for FASTA
+}
+
+// offset returns the file offset of base i (0-based), whose line starts at
+// from: the sequence or quality offset.
+func (r Record) offset(from, i int64) int64 {
+	return from + i/r.LineBases*r.LineWidth + i%r.LineBases
+}
+
+// Index is a .fai index, with records in file order.
+type Index struct {
+	Records []Record
+	byName  map[string]int
+}
+
+func newIndex() *Index {
+	return &Index{byName: make(map[string]int)}
+}
+
+func (idx *Index) add(rec Record) error {
+	if _, dup := idx.byName[rec.Name]; dup {
+		return fmt.Errorf("faidx: duplicate sequence name %q", rec.Name)
+	}
+	if rec.Length > 0 && rec.LineBases <= 0 {
+		return fmt.Errorf("faidx: bad line length for %q", rec.Name)
+	}
+	idx.byName[rec.Name] = len(idx.Records)
+	idx.Records = append(idx.Records, rec)
+	return nil
+}
+
+// Lookup returns the record of the named sequence.
+func (idx *Index) Lookup(name string) (Record, bool) {
+	i, ok := idx.byName[name]
+	if !ok {
+		return Record{}, false
+	}
+	return idx.Records[i], true
+}
+
+// fits reports whether the indexed bases and qualities all lie within the
+// first size bytes of the file, as they must unless the file has shrunk since
+// it was indexed.
+func (idx *Index) fits(size int64) bool {
+	for _, rec := range idx.Records {
+		if rec.Length == 0 {
+			continue
+		}
+		if rec.offset(rec.Offset, rec.Length-1) >= size {
+			return false
+		}
+		if rec.QualOffset > 0 && rec.offset(rec.QualOffset, rec.Length-1) >= size {
+			return false
+		}
+	}
+	return true
+}
+
+// Read reads a .fai index, with 5 columns for FASTA or 6 for FASTQ.
+func Read(r io.Reader) (*Index, error) {
+	idx := newIndex()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if scanner.Text() == "" {
+			continue
+		}
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 5 && len(fields) != 6 {
+			return nil, fmt.Errorf("faidx: line %d: expected 5 or 6 columns, found %d", line, len(fields))
+		}
+		values := make([]int64, 5)
+		for i, f := range fields[1:] {
+			v, err := strconv.ParseInt(f, 10, 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("faidx: line %d: bad number %q", line, f)
+			}
+			values[i] = v
+		}
+		rec := Record{fields[0], values[0], values[1], values[2], values[3], values[4]}
+		if err := idx.add(rec); err != nil {
+			return nil, err
+		}
+	}
+	return idx, scanner.Err()
+}
+
+// Write writes the index in .fai format.
+func (idx *Index) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, r := range idx.Records {
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%d\t%d", r.Name, r.Length, r.Offset, r.LineBases, r.LineWidth)
+		if r.QualOffset > 0 {
+			fmt.Fprintf(bw, "\t%d", r.QualOffset)
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// lineReader reads lines of any length, keeping only their first bytes.
+type lineReader struct {
+	r   *bufio.Reader
+	off int64
+}
+
+// line describes a line read by lineReader.
+type line struct {
+	start  int64  // offset of the first byte
+	length int64  // excluding the line terminator
+	width  int64  // including the line terminator
+	head   []byte // up to the first 4 KiB, for header lines
+}
+
+func (lr *lineReader) next() (l line, err error) {
+	l.start = lr.off
+	// The last two bytes of the line, to recognize "\n" and "\r\n".
+	var prev, last byte
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		l.width += int64(len(chunk))
+		if len(l.head) < 4096 {
+			l.head = append(l.head, chunk[:min(len(chunk), 4096-len(l.head))]...)
+		}
+		switch len(chunk) {
+		case 0:
+		case 1:
+			prev, last = last, chunk[0]
+		default:
+			prev, last = chunk[len(chunk)-2], chunk[len(chunk)-1]
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		lr.off += l.width
+		if err == io.EOF && l.width > 0 {
+			err = nil
+		}
+		if err != nil {
+			return l, err
+		}
+		break
+	}
+	l.length = l.width
+	if last == '\n' {
+		l.length--
+		if prev == '\r' && l.length > 0 {
+			l.length--
+		}
+	}
+	l.head = bytes.TrimRight(l.head, "\r\n")
+	return l, nil
+}
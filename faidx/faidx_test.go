@@ -0,0 +1,364 @@
+package faidx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eernst/catseq/bgzf"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string // in ../testdata, instead of data
+		data    string
+		want    string
+		wantErr string
+	}{
+		{
+			// As samtools faidx indexes it.
+			name: "test.fasta",
+			file: "test.fasta",
+			want: "AB000263\t368\t107\t70\t71\n",
+		},
+		{
+			name: "test.fastq",
+			file: "test.fastq",
+			want: "SRR001666.1\t36\t56\t36\t37\t149\n" +
+				"HWI-EAS209_0006_FC706VJ:5:58:5894:21141#ATCACG/1\t100\t236\t100\t101\t387\n",
+		},
+		{
+			name: "wrapped",
+			data: ">a desc\nACGT\nACGT\nAC\n>b\nACGTA\n",
+			want: "a\t10\t8\t4\t5\nb\t5\t24\t5\t6\n",
+		},
+		{
+			name: "CRLF",
+			data: ">a\r\nACG\r\nA\r\n",
+			want: "a\t4\t4\t3\t5\n",
+		},
+		{
+			name: "no final newline",
+			data: ">a\nACGT\nAC",
+			want: "a\t6\t3\t4\t5\n",
+		},
+		{
+			name: "empty sequence",
+			data: ">a\n>b\nAC\n",
+			want: "a\t0\t3\t0\t0\nb\t2\t6\t2\t3\n",
+		},
+		{
+			name: "blank lines",
+			data: "\n>a\nACGT\nAC\n\n\n>b\nA\n",
+			want: "a\t6\t4\t4\t5\nb\t1\t17\t1\t2\n",
+		},
+		{
+			name: "multi-line FASTQ",
+			data: "@r\nACGT\nAC\n+\nIIII\nII\n@s\nA\n+s\nI\n",
+			want: "r\t6\t3\t4\t5\t13\ns\t1\t24\t1\t2\t29\n",
+		},
+		{
+			name: "empty",
+			data: "",
+			want: "",
+		},
+		{name: "longer line", data: ">a\nACG\nACGT\n", wantErr: "different line length"},
+		{name: "line after a short line", data: ">a\nACGT\nAC\nACGT\n", wantErr: "different line length"},
+		{name: "line after a blank line", data: ">a\nACGT\n\nACGT\n", wantErr: "different line length"},
+		{name: "mixed line terminators", data: ">a\nACGT\r\nACGT\nA\n", wantErr: "different line terminators"},
+		{name: "duplicate name", data: ">a\nA\n>a x\nC\n", wantErr: "duplicate sequence name"},
+		{name: "truncated FASTQ", data: "@r\nACGT\n+\nII", wantErr: "truncated FASTQ record"},
+		{name: "FASTQ qualities laid out differently", data: "@r\nACGT\nAC\n+\nIII\nIII\n", wantErr: "laid out differently"},
+		{name: "not FASTA or FASTQ", data: "ACGT\n", wantErr: "not in FASTA or FASTQ format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			if tt.file != "" {
+				var err error
+				if data, err = os.ReadFile(filepath.Join("..", "testdata", tt.file)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			idx, err := Build(bytes.NewReader(data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fai strings.Builder
+			if err := idx.Write(&fai); err != nil {
+				t.Fatal(err)
+			}
+			if fai.String() != tt.want {
+				t.Errorf("index:\n%s\nwant:\n%s", fai.String(), tt.want)
+			}
+
+			// The index reads back as written.
+			read, err := Read(strings.NewReader(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(read.Records) != len(idx.Records) {
+				t.Fatalf("read %d records, want %d", len(read.Records), len(idx.Records))
+			}
+			for i, rec := range read.Records {
+				if rec != idx.Records[i] {
+					t.Errorf("read %+v, want %+v", rec, idx.Records[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fai  string
+		want string
+	}{
+		{"too few columns", "a\t4\t3\t4\n", "expected 5 or 6 columns"},
+		{"too many columns", "a\t4\t3\t4\t5\t6\t7\n", "expected 5 or 6 columns"},
+		{"not a number", "a\t4\tx\t4\t5\n", "bad number"},
+		{"negative", "a\t-4\t3\t4\t5\n", "bad number"},
+		{"no line length", "a\t4\t3\t0\t0\n", "bad line length"},
+		{"duplicate name", "a\t4\t3\t4\t5\na\t4\t10\t4\t5\n", "duplicate sequence name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.fai))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	idx, err := Read(strings.NewReader("chr1\t1000\t6\t60\t61\nHLA:A*01\t50\t1030\t60\t61\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		region  string
+		want    Region
+		str     string
+		wantErr string
+	}{
+		{region: "chr1", want: Region{"chr1", 0, 1000, true}, str: "chr1"},
+		{region: "chr1:11-20", want: Region{"chr1", 10, 20, false}, str: "chr1:11-20"},
+		{region: "chr1:1-1", want: Region{"chr1", 0, 1, false}, str: "chr1:1-1"},
+		{region: "chr1:900", want: Region{"chr1", 899, 1000, false}, str: "chr1:900-1000"},
+		{region: "chr1:900-", want: Region{"chr1", 899, 1000, false}, str: "chr1:900-1000"},
+		{region: "chr1:1,000", want: Region{"chr1", 999, 1000, false}, str: "chr1:1000-1000"},
+		{region: "chr1:990-2,000", want: Region{"chr1", 989, 1000, false}, str: "chr1:990-1000"},
+		{region: "HLA:A*01", want: Region{"HLA:A*01", 0, 50, true}, str: "HLA:A*01"},
+		{region: "HLA:A*01:5-10", want: Region{"HLA:A*01", 4, 10, false}, str: "HLA:A*01:5-10"},
+		{region: "chr2", wantErr: "not found"},
+		{region: "chr2:1-10", wantErr: "not found"},
+		{region: "chr1:0-10", wantErr: "positions start at 1"},
+		{region: "chr1:x", wantErr: "positions start at 1"},
+		{region: "chr1:20-10", wantErr: "end must be a position after start"},
+		{region: "chr1:1001-1002", wantErr: "starts after the end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			r, err := ParseRegion(tt.region, idx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r != tt.want || r.String() != tt.str {
+				t.Errorf("ParseRegion = %+v (%s), want %+v (%s)", r, r, tt.want, tt.str)
+			}
+		})
+	}
+}
+
+// writeFile writes data to name in dir, bgzipped if compress is set, and
+// returns its path.
+func writeFile(t *testing.T, dir, name, data string, compress bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if compress {
+		w := bgzf.NewWriter(&buf)
+		w.Write([]byte(data))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		buf.WriteString(data)
+	}
+	fileName := filepath.Join(dir, name)
+	if err := os.WriteFile(fileName, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestFetch(t *testing.T) {
+	long := strings.Repeat("ACGTACGTAC\n", 20000) // spans several BGZF blocks
+	files := []struct {
+		name string
+		data string
+	}{
+		{"wrapped.fa", ">a desc\nACGTA\nCGTAC\nGT\n>b\nTTGCA\n>empty\n>long\n" + long},
+		{"crlf.fa", ">a\r\nACGTA\r\nCGTAC\r\nGT\r\n>b\r\nTTGCA\r\n>empty\r\n>long\r\n" + strings.ReplaceAll(long, "\n", "\r\n")},
+		{"reads.fq", "@a\nACGTA\nCGTAC\nGT\n+\nABCDE\nFGHIJ\nKL\n@b\nTTGCA\n+\n!!!!!\n"},
+	}
+	tests := []struct {
+		name       string
+		seq        string
+		start, end int64
+		want       string
+		wantQual   string
+		fastaOnly  bool
+	}{
+		{name: "whole", seq: "a", start: 0, end: 12, want: "ACGTACGTACGT", wantQual: "ABCDEFGHIJKL"},
+		{name: "within a line", seq: "a", start: 1, end: 4, want: "CGT", wantQual: "BCD"},
+		{name: "across lines", seq: "a", start: 3, end: 11, want: "TACGTACG", wantQual: "DEFGHIJK"},
+		{name: "line start", seq: "a", start: 5, end: 6, want: "C", wantQual: "F"},
+		{name: "last line", seq: "a", start: 10, end: 12, want: "GT", wantQual: "KL"},
+		{name: "clipped", seq: "a", start: -3, end: 100, want: "ACGTACGTACGT", wantQual: "ABCDEFGHIJKL"},
+		{name: "empty range", seq: "a", start: 4, end: 4, want: ""},
+		{name: "second sequence", seq: "b", start: 2, end: 5, want: "GCA", wantQual: "!!!"},
+		{name: "empty sequence", seq: "empty", start: 0, end: 10, want: "", fastaOnly: true},
+		{name: "across BGZF blocks", seq: "long", start: 65270, end: 65300, want: strings.Repeat("ACGTACGTAC", 3), fastaOnly: true},
+	}
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		for _, file := range files {
+			name := file.name
+			if compress {
+				name += ".gz"
+			}
+			fastq := strings.HasSuffix(file.name, ".fq")
+			t.Run(name, func(t *testing.T) {
+				fileName := writeFile(t, dir, name, file.data, compress)
+				r, err := Open(fileName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer r.Close()
+				if _, err := os.Stat(FaiFileName(fileName)); err != nil {
+					t.Errorf("no .fai written: %v", err)
+				}
+				if _, err := os.Stat(GziFileName(fileName)); compress && err != nil {
+					t.Errorf("no .gzi written: %v", err)
+				}
+				for _, tt := range tests {
+					if fastq && tt.fastaOnly {
+						continue
+					}
+					s, q, err := r.Fetch(tt.seq, tt.start, tt.end)
+					if err != nil {
+						t.Fatalf("%s: %v", tt.name, err)
+					}
+					if string(s) != tt.want {
+						t.Errorf("%s: sequence = %q, want %q", tt.name, s, tt.want)
+					}
+					if fastq && string(q) != tt.wantQual {
+						t.Errorf("%s: qualities = %q, want %q", tt.name, q, tt.wantQual)
+					}
+					if !fastq && q != nil {
+						t.Errorf("%s: qualities = %q, want none", tt.name, q)
+					}
+				}
+				if _, _, err := r.Fetch("missing", 0, 1); err == nil {
+					t.Errorf("Fetch of a missing sequence succeeded")
+				}
+			})
+		}
+	}
+}
+
+func TestOpenGzip(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff})
+	fileName := writeFile(t, t.TempDir(), "plain.fa.gz", buf.String(), false)
+	if _, err := Open(fileName); err == nil || !strings.Contains(err.Error(), "bgzip") {
+		t.Errorf("error = %v, want one asking for bgzip", err)
+	}
+}
+
+func TestOpenStaleIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		fai      string
+		faiAge   time.Duration // how much older than the file the index is
+		wantSeq  string
+		rebuilds bool
+	}{
+		{name: "up to date", data: ">a\nACGT\n", fai: "a\t4\t3\t4\t5\n", faiAge: -time.Hour, wantSeq: "ACGT"},
+		// An index that is wrong but newer is trusted.
+		{name: "newer", data: ">a\nACGT\n", fai: "a\t2\t3\t4\t5\n", faiAge: -time.Hour, wantSeq: "AC"},
+		{name: "older", data: ">a\nACGT\nAC\n", fai: "a\t2\t3\t4\t5\n", faiAge: time.Hour, wantSeq: "ACGTAC", rebuilds: true},
+		{name: "beyond the end", data: ">a\nACGT\nAC\n", fai: "a\t100\t3\t4\t5\n", faiAge: -time.Hour, wantSeq: "ACGTAC", rebuilds: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := writeFile(t, t.TempDir(), "seqs.fa", tt.data, false)
+			faiName := FaiFileName(fileName)
+			if err := os.WriteFile(faiName, []byte(tt.fai), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			if err := os.Chtimes(fileName, now, now); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(faiName, now.Add(-tt.faiAge), now.Add(-tt.faiAge)); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := Open(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			s, _, err := r.Fetch("a", 0, 100)
+			if err != nil || string(s) != tt.wantSeq {
+				t.Errorf("Fetch = %q, %v, want %q", s, err, tt.wantSeq)
+			}
+			fai, err := os.ReadFile(faiName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rebuilt := string(fai) != tt.fai; rebuilt != tt.rebuilds {
+				t.Errorf("index rebuilt = %v, want %v", rebuilt, tt.rebuilds)
+			}
+		})
+	}
+}
+
+func TestIndexFile(t *testing.T) {
+	fileName := writeFile(t, t.TempDir(), "seqs.fa", ">a\nACGT\nAC\n", false)
+	// A newer but wrong index is replaced all the same.
+	if err := os.WriteFile(FaiFileName(fileName), []byte("a\t2\t3\t4\t5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := IndexFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fai, err := os.ReadFile(FaiFileName(fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a\t6\t3\t4\t5\n"; string(fai) != want || len(idx.Records) != 1 {
+		t.Errorf("index = %q, want %q", fai, want)
+	}
+}
@@ -0,0 +1,231 @@
+package faidx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/eernst/catseq/bgzf"
+	"github.com/eernst/catseq/twobit"
+)
+
+// Reader fetches subsequences of an indexed FASTA or FASTQ file, which may be
+// compressed with bgzip, or of a 2bit file, which is indexed already.
+type Reader struct {
+	Index  *Index
+	r      io.ReaderAt
+	file   *os.File
+	twoBit *twobit.File
+}
+
+// FaiFileName returns the name of the .fai index of fileName.
+func FaiFileName(fileName string) string {
+	return fileName + ".fai"
+}
+
+// GziFileName returns the name of the .gzi index of a bgzipped fileName.
+func GziFileName(fileName string) string {
+	return fileName + ".gzi"
+}
+
+// Open opens fileName for random access. Its .fai index, and its .gzi index
+// if it is compressed with bgzip, are read if present and up to date, and
+// otherwise built and written next to it when possible. An index is out of
+// date if it is older than the file, or indexes bases beyond its end.
+func Open(fileName string) (*Reader, error) {
+	return open(fileName, false)
+}
+
+// IndexFile (re)builds and writes the .fai index of fileName, and its .gzi
+// index if it is compressed with bgzip. 2bit files are left alone, returning
+// the index they hold.
+func IndexFile(fileName string) (*Index, error) {
+	r, err := open(fileName, true)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return r.Index, nil
+}
+
+func open(fileName string, rebuild bool) (*Reader, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newReader(f, fileName, rebuild)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return r, nil
+}
+
+func newReader(f *os.File, fileName string, rebuild bool) (*Reader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	r := &Reader{r: f, file: f}
+
+	header := make([]byte, 512)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+	if twobit.IsTwoBit(header) {
+		if r.twoBit, err = twobit.NewFile(f); err != nil {
+			return nil, err
+		}
+		r.Index = newIndex()
+		for _, s := range r.twoBit.Seqs {
+			// 2bit records have no lines.
+			if err := r.Index.add(Record{Name: s.Name, Length: s.Length, LineBases: s.Length}); err != nil {
+				return nil, err
+			}
+		}
+		return r, nil
+	}
+	compressed := bgzf.IsGzip(header)
+	if compressed {
+		if !bgzf.IsBGZF(header) {
+			return nil, fmt.Errorf("random access needs compression with bgzip rather than gzip")
+		}
+		var gzi bgzf.Index
+		if !rebuild {
+			gzi, err = readIndexFile(GziFileName(fileName), bgzf.ReadIndex)
+		}
+		if rebuild || os.IsNotExist(err) || isStale(GziFileName(fileName), info) {
+			if gzi, err = bgzf.BuildIndex(f, size); err != nil {
+				return nil, err
+			}
+			err = writeIndexFile(GziFileName(fileName), gzi.Write, rebuild)
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.r = bgzf.NewReaderAt(f, gzi)
+	}
+
+	if !rebuild {
+		r.Index, err = readIndexFile(FaiFileName(fileName), Read)
+	}
+	if rebuild || os.IsNotExist(err) || isStale(FaiFileName(fileName), info) || (err == nil && !compressed && !r.Index.fits(size)) {
+		var data io.Reader = io.NewSectionReader(f, 0, size)
+		if compressed {
+			if data, err = gzip.NewReader(data); err != nil {
+				return nil, err
+			}
+		}
+		if r.Index, err = Build(data); err != nil {
+			return nil, err
+		}
+		err = writeIndexFile(FaiFileName(fileName), r.Index.Write, rebuild)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// isStale reports whether an index file is older than the file it indexes,
+// which must then have changed since it was indexed.
+func isStale(indexFileName string, info os.FileInfo) bool {
+	indexInfo, err := os.Stat(indexFileName)
+	return err == nil && indexInfo.ModTime().Before(info.ModTime())
+}
+
+func readIndexFile[T any](fileName string, read func(io.Reader) (T, error)) (T, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		var none T
+		return none, err
+	}
+	defer f.Close()
+	index, err := read(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fileName, err)
+	}
+	return index, err
+}
+
+// writeIndexFile writes an index file. Unless required is set, failing to
+// write it is not an error, as the index can be rebuilt the next time.
+func writeIndexFile(fileName string, write func(io.Writer) error, required bool) error {
+	f, err := os.Create(fileName)
+	if err == nil {
+		err = write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(fileName)
+		}
+	}
+	if required {
+		return err
+	}
+	return nil
+}
+
+// Close closes the underlying file.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// Fetch returns bases start to end (0-based, half-open) of the named sequence,
+// clipped to its length, and their qualities for FASTQ files.
+func (r *Reader) Fetch(name string, start, end int64) (seq, qual []byte, err error) {
+	rec, ok := r.Index.Lookup(name)
+	if !ok {
+		return nil, nil, fmt.Errorf("sequence %q not found in index", name)
+	}
+	start, end = max(start, 0), min(end, rec.Length)
+	if start >= end {
+		return []byte{}, nil, nil
+	}
+	if r.twoBit != nil {
+		seq, err = r.twoBit.Fetch(name, start, end)
+		return seq, nil, err
+	}
+	if seq, err = r.read(rec, rec.Offset, start, end); err != nil {
+		return nil, nil, err
+	}
+	if rec.QualOffset > 0 {
+		if qual, err = r.read(rec, rec.QualOffset, start, end); err != nil {
+			return nil, nil, err
+		}
+	}
+	return seq, qual, nil
+}
+
+// read reads bases (or qualities) start to end of rec, starting at from, and
+// strips line terminators.
+func (r *Reader) read(rec Record, from, start, end int64) ([]byte, error) {
+	first, last := rec.offset(from, start), rec.offset(from, end-1)
+	buf := make([]byte, last-first+1)
+	if _, err := r.r.ReadAt(buf, first); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if int64(len(buf)) == end-start {
+		return buf, nil
+	}
+	out := buf[:0]
+	for len(buf) > 0 {
+		i := bytes.IndexAny(buf, "\r\n")
+		if i < 0 {
+			out = append(out, buf...)
+			break
+		}
+		out = append(out, buf[:i]...)
+		buf = buf[i+1:]
+	}
+	if int64(len(out)) != end-start {
+		return nil, fmt.Errorf("sequence %q does not match its index; rebuild it with catseq faidx", rec.Name)
+	}
+	return out, nil
+}
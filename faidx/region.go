@@ -0,0 +1,60 @@
+package faidx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Region is a part of a sequence, with 0-based, half-open coordinates.
+type Region struct {
+	Name  string
+	Start int64
+	End   int64
+	Whole bool // given as just the sequence name
+}
+
+// String formats the region as samtools does, with 1-based, inclusive
+// coordinates: "chr7:55000001-55200000", or just the name for a whole
+// sequence.
+func (r Region) String() string {
+	if r.Whole {
+		return r.Name
+	}
+	return fmt.Sprintf("%s:%d-%d", r.Name, r.Start+1, r.End)
+}
+
+// ParseRegion parses a samtools-style region NAME[:START[-END]] with 1-based,
+// inclusive coordinates, which may contain commas (e.g.
+// "chr7:55,000,001-55,200,000"). Names containing ':' are recognized by
+// looking them up in idx first. END defaults to, and is clipped to, the end of
+// the sequence.
+func ParseRegion(s string, idx *Index) (Region, error) {
+	if rec, ok := idx.Lookup(s); ok {
+		return Region{Name: s, Start: 0, End: rec.Length, Whole: true}, nil
+	}
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return Region{}, fmt.Errorf("sequence %q not found in index", s)
+	}
+	name, coords := s[:i], strings.ReplaceAll(s[i+1:], ",", "")
+	rec, ok := idx.Lookup(name)
+	if !ok {
+		return Region{}, fmt.Errorf("sequence %q not found in index", name)
+	}
+	startText, endText, hasEnd := strings.Cut(coords, "-")
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil || start < 1 {
+		return Region{}, fmt.Errorf("bad region %q: positions start at 1", s)
+	}
+	end := rec.Length
+	if hasEnd && endText != "" {
+		if end, err = strconv.ParseInt(endText, 10, 64); err != nil || end < start {
+			return Region{}, fmt.Errorf("bad region %q: end must be a position after start", s)
+		}
+	}
+	if start > rec.Length {
+		return Region{}, fmt.Errorf("region %q starts after the end of %s (%d bases)", s, name, rec.Length)
+	}
+	return Region{Name: name, Start: start - 1, End: min(end, rec.Length)}, nil
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"bytes"
+)
+
+// HeaderAttr returns the value of a key=value attribute embedded in a
+// sequence header, such as acc in
+//
+//	AB000263 |acc=AB000263|descr=Homo sapiens mRNA|len=368
+//
+// Attributes may be separated by '|', ';', tabs or spaces. Values end at the
+// next '|', ';' or tab, or at a space that is followed by another key=.
+func HeaderAttr(header []byte, key string) ([]byte, bool) {
+	if key == "" {
+		return nil, false
+	}
+	k := []byte(key)
+	for from := 0; from < len(header); {
+		i := bytes.Index(header[from:], k)
+		if i < 0 {
+			return nil, false
+		}
+		i += from
+		end := i + len(k)
+		if (i == 0 || isAttrSep(header[i-1])) && end < len(header) && header[end] == '=' {
+			return header[end+1 : attrValueEnd(header, end+1)], true
+		}
+		from = i + 1
+	}
+	return nil, false
+}
+
+// HeaderAttrs returns all key=value attributes of a header in order.
+func HeaderAttrs(header []byte) (keys [][]byte, values [][]byte) {
+	for i := 0; i < len(header); i++ {
+		if header[i] != '=' {
+			continue
+		}
+		start := i
+		for start > 0 && isAttrKeyChar(header[start-1]) {
+			start--
+		}
+		if start == i || (start > 0 && !isAttrSep(header[start-1])) {
+			continue
+		}
+		end := attrValueEnd(header, i+1)
+		keys = append(keys, header[start:i])
+		values = append(values, header[i+1:end])
+		i = end
+	}
+	return keys, values
+}
+
+func attrValueEnd(header []byte, from int) int {
+	for j := from; j < len(header); j++ {
+		switch header[j] {
+		case '|', ';', '\t':
+			return j
+		case ' ':
+			if nextIsKey(header[j+1:]) {
+				return j
+			}
+		}
+	}
+	return len(header)
+}
+
+func nextIsKey(b []byte) bool {
+	for i, c := range b {
+		if c == '=' {
+			return i > 0
+		}
+		if !isAttrKeyChar(c) {
+			return false
+		}
+	}
+	return false
+}
+
+func isAttrSep(c byte) bool {
+	return c == ' ' || c == '|' || c == ';' || c == '\t'
+}
+
+func isAttrKeyChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"errors"
 	"io"
 	"log"
 	"sync"
@@ -8,7 +9,12 @@ import (
 	"github.com/shenwei356/bio/seqio/fastx"
 )
 
-func ChannelRec(reader *fastx.Reader) <-chan *fastx.Record {
+// RecordReader is a source of records, such as a fastx.Reader.
+type RecordReader interface {
+	Read() (*fastx.Record, error)
+}
+
+func ChannelRec(reader RecordReader) <-chan *fastx.Record {
 	out := make(chan *fastx.Record)
 	go func() {
 		for {
@@ -27,11 +33,57 @@ func ChannelRec(reader *fastx.Reader) <-chan *fastx.Record {
 	return out
 }
 
-// Copied from https://blog.golang.org/pipelines
-func MergeRec(chans ...<-chan *fastx.Record) chan *fastx.Record {
+// ChannelRecSets reads the readers in lockstep, emitting one record from each
+// per step. With two readers this yields read pairs from R1/R2 files; with a
+// single reader each set holds one record. All readers must hold the same
+// number of records.
+func ChannelRecSets(readers ...RecordReader) <-chan []*fastx.Record {
+	out := make(chan []*fastx.Record)
+	go func() {
+		for {
+			set, err := ReadRecSet(readers...)
+			if err == io.EOF {
+				break
+			}
+			check(err)
+			out <- set
+		}
+		close(out)
+	}()
+	return out
+}
+
+// ReadRecSet reads the next record from each reader, as ChannelRecSets does,
+// returning io.EOF once all readers are exhausted.
+func ReadRecSet(readers ...RecordReader) ([]*fastx.Record, error) {
+	set := make([]*fastx.Record, len(readers))
+	var eof int
+	for i, reader := range readers {
+		record, err := reader.Read()
+		if err == io.EOF {
+			eof++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		set[i] = record.Clone()
+	}
+	switch eof {
+	case 0:
+		return set, nil
+	case len(readers):
+		return nil, io.EOF
+	}
+	return nil, errors.New("paired inputs have different numbers of records")
+}
+
+// Merge fans in values from several channels to one, which is closed once
+// all of them are. Copied from https://blog.golang.org/pipelines
+func Merge[T any](chans ...<-chan T) chan T {
 	var wg sync.WaitGroup
-	out := make(chan *fastx.Record)
-	output := func(c <-chan *fastx.Record) {
+	out := make(chan T)
+	output := func(c <-chan T) {
 		for n := range c {
 			out <- n
 		}
@@ -48,6 +100,11 @@ func MergeRec(chans ...<-chan *fastx.Record) chan *fastx.Record {
 	return out
 }
 
+// MergeRec merges channels of records, as Merge does.
+func MergeRec(chans ...<-chan *fastx.Record) chan *fastx.Record {
+	return Merge(chans...)
+}
+
 func check(e error) {
 	if e != nil {
 		log.Fatal(e)
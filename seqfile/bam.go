@@ -0,0 +1,458 @@
+package seqfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/eernst/catseq/bgzf"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// bamMagic starts the uncompressed data of a BAM file.
+var bamMagic = []byte("BAM\x01")
+
+// bamBases decodes the 4-bit bases of BAM records.
+const bamBases = "=ACMGRSVTWYHKDBN"
+
+// bamBaseCodes encodes bases as in BAM records, anything unknown as N.
+var bamBaseCodes [256]byte
+
+func init() {
+	for i := range bamBaseCodes {
+		bamBaseCodes[i] = 15
+	}
+	for i := 0; i < len(bamBases); i++ {
+		bamBaseCodes[bamBases[i]] = byte(i)
+		bamBaseCodes[bamBases[i]|0x20] = byte(i)
+	}
+}
+
+// bamReader reads the reads of a BAM file as samReader does those of a SAM
+// file.
+type bamReader struct {
+	r      *bufio.Reader
+	close  func()
+	record []byte
+	n      int
+}
+
+// openBAM opens a BAM file ("-" for STDIN), decompressing its BGZF blocks.
+func openBAM(fileName string) (*bamReader, error) {
+	fh := os.Stdin
+	if fileName != "-" {
+		var err error
+		if fh, err = os.Open(fileName); err != nil {
+			return nil, err
+		}
+	}
+	r, err := newBAMReader(bgzf.NewReader(bufio.NewReaderSize(fh, bgzf.MaxBlockSize)), func() { fh.Close() })
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("%v: %s", err, fileName)
+	}
+	return r, nil
+}
+
+// newBAMReader reads a BAM file from its uncompressed data, starting with the
+// header, which is skipped.
+func newBAMReader(data io.Reader, close func()) (*bamReader, error) {
+	r := &bamReader{r: bufio.NewReaderSize(data, 1<<16), close: close}
+	magic := make([]byte, len(bamMagic))
+	if _, err := io.ReadFull(r.r, magic); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	} else if err != nil || !bytes.Equal(magic, bamMagic) {
+		return nil, fmt.Errorf("seqfile: not a BAM file")
+	}
+	// The header text, then the names and lengths of the references.
+	textLen, err := r.int32()
+	if err == nil {
+		_, err = r.r.Discard(int(textLen))
+	}
+	var nRef int32
+	if err == nil {
+		nRef, err = r.int32()
+	}
+	for i := int32(0); err == nil && i < nRef; i++ {
+		var nameLen int32
+		if nameLen, err = r.int32(); err == nil {
+			_, err = r.r.Discard(int(nameLen) + 4)
+		}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("seqfile: truncated BAM header")
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *bamReader) int32() (int32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r.r, b[:]); err != nil {
+		return 0, err
+	}
+	n := int32(binary.LittleEndian.Uint32(b[:]))
+	if n < 0 {
+		return 0, fmt.Errorf("seqfile: negative BAM length")
+	}
+	return n, nil
+}
+
+func (r *bamReader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("seqfile: BAM record %d: %s", r.n, fmt.Sprintf(format, args...))
+}
+
+func (r *bamReader) Read() (*fastx.Record, error) {
+	for {
+		size, err := r.int32()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		r.n++
+		if err == nil {
+			if cap(r.record) < int(size) {
+				r.record = make([]byte, size)
+			}
+			_, err = io.ReadFull(r.r, r.record[:size])
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, r.errorf("truncated")
+		} else if err != nil {
+			return nil, r.errorf("%v", err)
+		}
+		b := r.record[:size]
+		if len(b) < 32 {
+			return nil, r.errorf("too short")
+		}
+
+		nameLen := int(b[8])
+		nCigar := int(binary.LittleEndian.Uint16(b[12:14]))
+		flag := uint64(binary.LittleEndian.Uint16(b[14:16]))
+		seqLen := int(int32(binary.LittleEndian.Uint32(b[16:20])))
+		if flag&(flagSecondary|flagSupplementary) != 0 {
+			continue
+		}
+		i := 32 + nameLen + 4*nCigar
+		if nameLen < 1 || seqLen < 0 || i+(seqLen+1)/2+seqLen > len(b) {
+			return nil, r.errorf("bad lengths")
+		}
+		qname := b[32 : 32+nameLen-1]
+
+		s := make([]byte, seqLen)
+		for j := range s {
+			code := b[i+j/2] >> 4
+			if j%2 == 1 {
+				code = b[i+j/2] & 0xf
+			}
+			s[j] = bamBases[code]
+		}
+		i += (seqLen + 1) / 2
+		var q []byte
+		if seqLen > 0 && b[i] != 0xff {
+			q = make([]byte, seqLen)
+			for j := range q {
+				q[j] = b[i+j] + 33
+			}
+		}
+		i += seqLen
+
+		var tags [][]byte
+		for i < len(b) {
+			tag, n, err := bamTagText(b[i:])
+			if err != nil {
+				return nil, r.errorf("%v", err)
+			}
+			tags = append(tags, tag)
+			i += n
+		}
+		return samRecord(qname, flag, s, q, tags)
+	}
+}
+
+func (r *bamReader) Close() { r.close() }
+
+// bamTagText decodes the tag starting data into its SAM text form, returning
+// that and the length of the encoded tag.
+func bamTagText(data []byte) ([]byte, int, error) {
+	if len(data) < 4 {
+		return nil, 0, fmt.Errorf("truncated tag")
+	}
+	typ := data[2]
+	text := append([]byte(nil), data[0], data[1], ':')
+	value := data[3:]
+	switch typ {
+	case 'A':
+		return append(text, 'A', ':', value[0]), 4, nil
+	case 'Z', 'H':
+		end := bytes.IndexByte(value, 0)
+		if end < 0 {
+			return nil, 0, fmt.Errorf("unterminated tag %s", data[:2])
+		}
+		return append(append(text, typ, ':'), value[:end]...), 3 + end + 1, nil
+	case 'B':
+		if len(value) < 5 {
+			return nil, 0, fmt.Errorf("truncated tag %s", data[:2])
+		}
+		sub := value[0]
+		size := bamValueSize(sub)
+		count := int(binary.LittleEndian.Uint32(value[1:5]))
+		if size == 0 || count < 0 || len(value) < 5+count*size {
+			return nil, 0, fmt.Errorf("bad array tag %s", data[:2])
+		}
+		text = append(text, 'B', ':', sub)
+		for j := 0; j < count; j++ {
+			text = append(text, ',')
+			text = appendBAMValue(text, sub, value[5+j*size:])
+		}
+		return text, 3 + 5 + count*size, nil
+	}
+	size := bamValueSize(typ)
+	if size == 0 || len(value) < size {
+		return nil, 0, fmt.Errorf("bad tag %s of type %c", data[:2], typ)
+	}
+	if typ == 'f' {
+		text = append(text, 'f', ':')
+	} else {
+		text = append(text, 'i', ':')
+	}
+	return appendBAMValue(text, typ, value), 3 + size, nil
+}
+
+// bamValueSize returns the size of a numeric BAM tag value of the given type,
+// or 0 if the type isn't numeric.
+func bamValueSize(typ byte) int {
+	switch typ {
+	case 'c', 'C':
+		return 1
+	case 's', 'S':
+		return 2
+	case 'i', 'I', 'f':
+		return 4
+	}
+	return 0
+}
+
+// appendBAMValue appends the text of the numeric value of the given type at
+// the start of b.
+func appendBAMValue(dst []byte, typ byte, b []byte) []byte {
+	switch typ {
+	case 'c':
+		return strconv.AppendInt(dst, int64(int8(b[0])), 10)
+	case 'C':
+		return strconv.AppendInt(dst, int64(b[0]), 10)
+	case 's':
+		return strconv.AppendInt(dst, int64(int16(binary.LittleEndian.Uint16(b))), 10)
+	case 'S':
+		return strconv.AppendInt(dst, int64(binary.LittleEndian.Uint16(b)), 10)
+	case 'i':
+		return strconv.AppendInt(dst, int64(int32(binary.LittleEndian.Uint32(b))), 10)
+	case 'I':
+		return strconv.AppendInt(dst, int64(binary.LittleEndian.Uint32(b)), 10)
+	}
+	return strconv.AppendFloat(dst, float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 'g', -1, 32)
+}
+
+// appendBAMTag encodes a tag in SAM text form, e.g. "RG:Z:lane1", as in BAM
+// records. Integers are stored in the smallest type that holds them.
+func appendBAMTag(dst, tag []byte) ([]byte, error) {
+	if len(tag) < 5 || tag[2] != ':' || tag[4] != ':' || !isTagChar(tag[0], false) || !isTagChar(tag[1], true) {
+		return dst, fmt.Errorf("seqfile: bad SAM tag %q", tag)
+	}
+	typ, value := tag[3], tag[5:]
+	dst = append(dst, tag[0], tag[1])
+	switch typ {
+	case 'A':
+		if len(value) != 1 {
+			break
+		}
+		return append(dst, 'A', value[0]), nil
+	case 'i':
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil || n < math.MinInt32 || n > math.MaxUint32 {
+			break
+		}
+		return appendBAMInt(dst, n), nil
+	case 'f':
+		f, err := strconv.ParseFloat(string(value), 32)
+		if err != nil {
+			break
+		}
+		return binary.LittleEndian.AppendUint32(append(dst, 'f'), math.Float32bits(float32(f))), nil
+	case 'Z':
+		if bytes.IndexByte(value, 0) >= 0 {
+			break
+		}
+		return append(append(append(dst, 'Z'), value...), 0), nil
+	case 'H':
+		if len(value)%2 == 1 {
+			break
+		}
+		if _, err := hex.DecodeString(string(value)); err != nil {
+			break
+		}
+		return append(append(append(dst, 'H'), value...), 0), nil
+	case 'B':
+		if len(value) == 0 || bamValueSize(value[0]) == 0 {
+			break
+		}
+		sub := value[0]
+		values := bytes.Split(value[1:], []byte{','})
+		if len(values[0]) > 0 {
+			break
+		}
+		values = values[1:]
+		dst = binary.LittleEndian.AppendUint32(append(dst, 'B', sub), uint32(len(values)))
+		for _, v := range values {
+			var ok bool
+			if dst, ok = appendBAMArrayValue(dst, sub, string(v)); !ok {
+				return dst, fmt.Errorf("seqfile: bad SAM tag %q", tag)
+			}
+		}
+		return dst, nil
+	}
+	return dst, fmt.Errorf("seqfile: bad SAM tag %q", tag)
+}
+
+// isTagChar reports whether c may be the first (digit false) or second
+// character of a tag name.
+func isTagChar(c byte, digit bool) bool {
+	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || (digit && '0' <= c && c <= '9')
+}
+
+// appendBAMInt appends an integer tag value in the smallest type holding it.
+func appendBAMInt(dst []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= math.MaxUint8:
+		return append(dst, 'C', byte(n))
+	case n >= math.MinInt8 && n < 0:
+		return append(dst, 'c', byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		return binary.LittleEndian.AppendUint16(append(dst, 'S'), uint16(n))
+	case n >= math.MinInt16 && n < 0:
+		return binary.LittleEndian.AppendUint16(append(dst, 's'), uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		return binary.LittleEndian.AppendUint32(append(dst, 'I'), uint32(n))
+	}
+	return binary.LittleEndian.AppendUint32(append(dst, 'i'), uint32(n))
+}
+
+// appendBAMArrayValue appends an element of a B (array) tag of the given
+// element type, reporting whether it is valid and in range.
+func appendBAMArrayValue(dst []byte, sub byte, v string) ([]byte, bool) {
+	if sub == 'f' {
+		f, err := strconv.ParseFloat(v, 32)
+		return binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(f))), err == nil
+	}
+	size := bamValueSize(sub)
+	var n int64
+	var err error
+	if sub == 'c' || sub == 's' || sub == 'i' {
+		n, err = strconv.ParseInt(v, 10, size*8)
+	} else {
+		var u uint64
+		u, err = strconv.ParseUint(v, 10, size*8)
+		n = int64(u)
+	}
+	switch size {
+	case 1:
+		dst = append(dst, byte(n))
+	case 2:
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(n))
+	default:
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(n))
+	}
+	return dst, err == nil
+}
+
+// bamWriter writes records as unaligned reads in BAM, like samWriter does in
+// SAM.
+type bamWriter struct {
+	w       *bgzf.Writer
+	started bool
+	record  []byte
+}
+
+func newBAMWriter(w *xopen.Writer) *bamWriter {
+	return &bamWriter{w: bgzf.NewWriter(w)}
+}
+
+func (w *bamWriter) header() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	text := "@HD\tVN:1.6\tSO:unknown\n"
+	b := append([]byte(nil), bamMagic...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(text)))
+	b = append(b, text...)
+	b = binary.LittleEndian.AppendUint32(b, 0) // no references
+	_, err := w.w.Write(b)
+	return err
+}
+
+func (w *bamWriter) Write(rec *fastx.Record) error {
+	if err := w.header(); err != nil {
+		return err
+	}
+	qname, flag, tags := samFields(rec)
+	if len(qname) > 254 {
+		return fmt.Errorf("seqfile: read name %s is too long for BAM", qname)
+	}
+	s, q := rec.Seq.Seq, rec.Seq.Qual
+
+	unmapped := uint32(math.MaxUint32)                     // -1, for no reference or position
+	b := binary.LittleEndian.AppendUint32(w.record[:0], 0) // block size, set below
+	b = binary.LittleEndian.AppendUint32(b, unmapped)      // reference
+	b = binary.LittleEndian.AppendUint32(b, unmapped)      // position
+	b = append(b, byte(len(qname)+1), 0)                   // name length, mapping quality
+	b = binary.LittleEndian.AppendUint16(b, 4680)          // bin of unmapped reads
+	b = binary.LittleEndian.AppendUint16(b, 0)             // CIGAR operations
+	b = binary.LittleEndian.AppendUint16(b, uint16(flag))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+	b = binary.LittleEndian.AppendUint32(b, unmapped) // mate reference
+	b = binary.LittleEndian.AppendUint32(b, unmapped) // mate position
+	b = binary.LittleEndian.AppendUint32(b, 0)        // template length
+	b = append(append(b, qname...), 0)
+	for i := 0; i < len(s); i += 2 {
+		code := bamBaseCodes[s[i]] << 4
+		if i+1 < len(s) {
+			code |= bamBaseCodes[s[i+1]]
+		}
+		b = append(b, code)
+	}
+	if len(q) == len(s) {
+		for _, c := range q {
+			b = append(b, c-33)
+		}
+	} else {
+		for range s {
+			b = append(b, 0xff)
+		}
+	}
+	for _, tag := range tags {
+		var err error
+		if b, err = appendBAMTag(b, tag); err != nil {
+			return err
+		}
+	}
+	binary.LittleEndian.PutUint32(b[:4], uint32(len(b)-4))
+	w.record = b
+	_, err := w.w.Write(b)
+	return err
+}
+
+func (w *bamWriter) Close() error {
+	if err := w.header(); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
@@ -0,0 +1,339 @@
+package seqfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eernst/catseq/bgzf"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+func TestBAMTagRoundTrip(t *testing.T) {
+	tests := []struct {
+		tag     string
+		typ     byte // as encoded
+		want    string
+		wantErr bool
+	}{
+		{tag: "RG:Z:lane1", typ: 'Z', want: "RG:Z:lane1"},
+		{tag: "CO:Z:", typ: 'Z', want: "CO:Z:"},
+		{tag: "XA:A:x", typ: 'A', want: "XA:A:x"},
+		{tag: "NM:i:0", typ: 'C', want: "NM:i:0"},
+		{tag: "NM:i:255", typ: 'C', want: "NM:i:255"},
+		{tag: "NM:i:256", typ: 'S', want: "NM:i:256"},
+		{tag: "NM:i:-1", typ: 'c', want: "NM:i:-1"},
+		{tag: "NM:i:-128", typ: 'c', want: "NM:i:-128"},
+		{tag: "NM:i:-129", typ: 's', want: "NM:i:-129"},
+		{tag: "NM:i:65535", typ: 'S', want: "NM:i:65535"},
+		{tag: "NM:i:65536", typ: 'I', want: "NM:i:65536"},
+		{tag: "NM:i:-32769", typ: 'i', want: "NM:i:-32769"},
+		{tag: "NM:i:4294967295", typ: 'I', want: "NM:i:4294967295"},
+		{tag: "NM:i:-2147483648", typ: 'i', want: "NM:i:-2147483648"},
+		{tag: "XF:f:1.5", typ: 'f', want: "XF:f:1.5"},
+		{tag: "XF:f:-0.25", typ: 'f', want: "XF:f:-0.25"},
+		{tag: "XH:H:1AE301", typ: 'H', want: "XH:H:1AE301"},
+		{tag: "XB:B:c,-128,127", typ: 'B', want: "XB:B:c,-128,127"},
+		{tag: "XB:B:C,0,255", typ: 'B', want: "XB:B:C,0,255"},
+		{tag: "XB:B:s,-300,300", typ: 'B', want: "XB:B:s,-300,300"},
+		{tag: "XB:B:S,65535", typ: 'B', want: "XB:B:S,65535"},
+		{tag: "XB:B:i,-70000,5", typ: 'B', want: "XB:B:i,-70000,5"},
+		{tag: "XB:B:I,4294967295", typ: 'B', want: "XB:B:I,4294967295"},
+		{tag: "XB:B:f,1.5,-2", typ: 'B', want: "XB:B:f,1.5,-2"},
+		{tag: "XB:B:C", typ: 'B', want: "XB:B:C"},
+		{tag: "X1:Z:digit", typ: 'Z', want: "X1:Z:digit"},
+
+		{tag: "NM:i:x", wantErr: true},
+		{tag: "NM:i:4294967296", wantErr: true},
+		{tag: "NM:i:-2147483649", wantErr: true},
+		{tag: "XF:f:one", wantErr: true},
+		{tag: "XA:A:ab", wantErr: true},
+		{tag: "XH:H:1", wantErr: true},
+		{tag: "XH:H:zz", wantErr: true},
+		{tag: "XB:B:C,256", wantErr: true},
+		{tag: "XB:B:c,-129", wantErr: true},
+		{tag: "XB:B:q,1", wantErr: true},
+		{tag: "XB:B:c1,2", wantErr: true},
+		{tag: "XB:B:", wantErr: true},
+		{tag: "1X:Z:a", wantErr: true},
+		{tag: "XZ:Z", wantErr: true},
+		{tag: "XZ-Z:a", wantErr: true},
+		{tag: "XQ:Q:a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			enc, err := appendBAMTag(nil, []byte(tt.tag))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("appendBAMTag(%q) = %q, want an error", tt.tag, enc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("appendBAMTag(%q): %v", tt.tag, err)
+			}
+			if enc[2] != tt.typ {
+				t.Errorf("encoded as type %c, want %c", enc[2], tt.typ)
+			}
+			// Trailing bytes, such as the next tag, are left alone.
+			text, n, err := bamTagText(append(enc, "XXZx\x00"...))
+			if err != nil {
+				t.Fatalf("bamTagText: %v", err)
+			}
+			if string(text) != tt.want || n != len(enc) {
+				t.Errorf("bamTagText = %q, %d, want %q, %d", text, n, tt.want, len(enc))
+			}
+		})
+	}
+}
+
+func TestBAMTagTextErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"too short", "RG"},
+		{"unterminated string", "RGZlane1"},
+		{"unterminated hex", "XHH1A"},
+		{"short integer", "NMs\x01"},
+		{"unknown type", "XQQab"},
+		{"truncated array header", "XBBc\x02\x00"},
+		{"bad array type", "XBBq\x01\x00\x00\x00\x01"},
+		{"short array", "XBBs\x02\x00\x00\x00\x01\x00\x02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if text, _, err := bamTagText([]byte(tt.data)); err == nil {
+				t.Errorf("bamTagText(%q) = %q, want an error", tt.data, text)
+			}
+		})
+	}
+}
+
+// writeBAM writes records to a BAM file in dir and returns its name.
+func writeBAM(t *testing.T, dir string, recs []*fastx.Record) string {
+	t.Helper()
+	fileName := filepath.Join(dir, "test.bam")
+	fh, err := xopen.Wopen(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(fh, BAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("Write(%s): %v", rec.Name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func mustRecord(t *testing.T, name, s string, q []byte) *fastx.Record {
+	t.Helper()
+	rec, err := newRecord([]byte(name), []byte(s), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestBAMRoundTrip(t *testing.T) {
+	long := strings.Repeat("ACGTTGCAN", 100000/9)
+	longQual := bytes.Repeat([]byte("I#5"), len(long)/3+1)[:len(long)]
+	tests := []struct {
+		name     string
+		s        string
+		q        string
+		noQual   bool
+		wantName string
+		wantSeq  string
+	}{
+		{name: "odd", s: "ACGTA", q: "IIII#"},
+		{name: "even", s: "ACGT", q: "!!~~"},
+		{name: "single", s: "G", q: "5"},
+		{name: "no-qual", s: "ACGTN", noQual: true},
+		{name: "empty", s: "", noQual: true},
+		{name: "iupac", s: "=ACMGRSVTWYHKDBN", q: "IIIIIIIIIIIIIIII"},
+		{name: "lower", s: "acgtn", q: "IIIII", wantSeq: "ACGTN"},
+		{name: "unknown", s: "AC.-X", q: "IIIII", wantSeq: "ACNNN"},
+		{name: "pair/1", s: "ACG", q: "III"},
+		{name: "pair/2", s: "CGT", q: "III"},
+		{name: "tagged RG:Z:lane1 BC:Z:ACGT", s: "AC", q: "II"},
+		{name: "commented some free text", s: "AC", q: "II"},
+		{name: "mixed hello RG:Z:x world", s: "AC", q: "II", wantName: "mixed RG:Z:x hello world"},
+		{name: "untagged XX:Z:y", s: "AC", q: "II"},
+		{name: "long", s: long, q: string(longQual)},
+	}
+	var recs []*fastx.Record
+	for _, tt := range tests {
+		var q []byte
+		if !tt.noQual {
+			q = []byte(tt.q)
+		}
+		recs = append(recs, mustRecord(t, tt.name, tt.s, q))
+	}
+	fileName := writeBAM(t, t.TempDir(), recs)
+
+	r, err := NewReader(fileName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, tt := range tests {
+		rec, err := r.Read()
+		if err != nil {
+			t.Fatalf("%s: Read: %v", tt.name, err)
+		}
+		wantName, wantSeq := tt.name, tt.s
+		if tt.wantName != "" {
+			wantName = tt.wantName
+		}
+		if tt.wantSeq != "" {
+			wantSeq = tt.wantSeq
+		}
+		if string(rec.Name) != wantName {
+			t.Errorf("name = %q, want %q", rec.Name, wantName)
+		}
+		if string(rec.Seq.Seq) != wantSeq {
+			t.Errorf("%s: sequence = %.40q, want %.40q", tt.name, rec.Seq.Seq, wantSeq)
+		}
+		if tt.noQual && len(rec.Seq.Qual) != 0 {
+			t.Errorf("%s: qualities = %q, want none", tt.name, rec.Seq.Qual)
+		} else if !tt.noQual && string(rec.Seq.Qual) != tt.q {
+			t.Errorf("%s: qualities = %.40q, want %.40q", tt.name, rec.Seq.Qual, tt.q)
+		}
+	}
+	if rec, err := r.Read(); err != io.EOF {
+		t.Errorf("Read after the last record = %v, %v, want io.EOF", rec, err)
+	}
+}
+
+// rawBAM returns the uncompressed data of a BAM file of recs.
+func rawBAM(t *testing.T, recs ...*fastx.Record) []byte {
+	t.Helper()
+	fh, err := xopen.Ropen(writeBAM(t, t.TempDir(), recs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	raw, err := io.ReadAll(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// bamHeaderLen is the length of the header written by bamWriter.
+const bamHeaderLen = 4 + 4 + len("@HD\tVN:1.6\tSO:unknown\n") + 4
+
+func readRawBAM(raw []byte) ([]*fastx.Record, error) {
+	r, err := newBAMReader(bytes.NewReader(raw), func() {})
+	if err != nil {
+		return nil, err
+	}
+	var recs []*fastx.Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return recs, err
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func TestBAMFlags(t *testing.T) {
+	const flagOffset = bamHeaderLen + 4 + 14
+	tests := []struct {
+		name     string
+		flag     uint16
+		wantSeqs []string
+		wantQual string
+	}{
+		{"unmapped", flagUnmapped, []string{"AACGT", "TTTT"}, "ABCDE"},
+		{"reverse", flagReverse, []string{"ACGTT", "TTTT"}, "EDCBA"},
+		{"secondary", flagSecondary, []string{"TTTT"}, ""},
+		{"supplementary", flagSupplementary, []string{"TTTT"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := rawBAM(t, mustRecord(t, "a", "AACGT", []byte("ABCDE")), mustRecord(t, "b", "TTTT", nil))
+			binary.LittleEndian.PutUint16(raw[flagOffset:], tt.flag)
+			recs, err := readRawBAM(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var seqs []string
+			for _, rec := range recs {
+				seqs = append(seqs, string(rec.Seq.Seq))
+			}
+			if strings.Join(seqs, " ") != strings.Join(tt.wantSeqs, " ") {
+				t.Errorf("sequences = %q, want %q", seqs, tt.wantSeqs)
+			}
+			if tt.wantQual != "" && string(recs[0].Seq.Qual) != tt.wantQual {
+				t.Errorf("qualities = %q, want %q", recs[0].Seq.Qual, tt.wantQual)
+			}
+		})
+	}
+}
+
+func TestBAMReadErrors(t *testing.T) {
+	valid := rawBAM(t, mustRecord(t, "a", "ACGT", []byte("IIII")))
+	badLength := bytes.Clone(valid)
+	binary.LittleEndian.PutUint32(badLength[bamHeaderLen+4+16:], 1000)
+	badTag := bytes.Clone(valid)
+	badTag = append(badTag, "XBBq"...)
+	binary.LittleEndian.PutUint32(badTag[bamHeaderLen:], uint32(len(badTag)-bamHeaderLen-4))
+
+	tests := []struct {
+		name string
+		raw  []byte
+		want string
+	}{
+		{"not BAM", []byte(">a\nACGT\n"), "not a BAM file"},
+		{"empty", nil, "not a BAM file"},
+		{"truncated header", valid[:bamHeaderLen-2], "truncated BAM header"},
+		{"truncated record", valid[:len(valid)-2], "truncated"},
+		{"short record", append(bytes.Clone(valid[:bamHeaderLen]), 4, 0, 0, 0, 1, 2, 3, 4), "too short"},
+		{"bad lengths", badLength, "bad lengths"},
+		{"truncated tag", badTag, "tag XB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readRawBAM(tt.raw)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBAMNotBGZF(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "plain.bam")
+	fh, err := xopen.Wopen(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bgzf.NewWriter(fh)
+	w.Write([]byte("hello"))
+	w.Close()
+	fh.Close()
+	if _, err := NewReader(fileName, ""); err == nil || !strings.Contains(err.Error(), "not a BAM file") {
+		t.Errorf("error = %v, want not a BAM file", err)
+	}
+}
@@ -0,0 +1,426 @@
+package seqfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eernst/catseq/annot"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// FeatureReader is a Reader of annotated sequences whose features can be
+// read along with each record.
+type FeatureReader interface {
+	Reader
+	// Features returns the features of the record last read, with
+	// coordinates on its sequence.
+	Features() []*annot.Feature
+}
+
+// flatFileReader reads GenBank or EMBL flat files. The two formats share the
+// layout of their feature tables, but name the other parts of a record
+// differently: GenBank with keywords such as LOCUS, DEFINITION and ORIGIN
+// over the first 12 columns, EMBL with two-letter line codes such as ID, DE
+// and SQ followed by three spaces.
+type flatFileReader struct {
+	fh       *xopen.Reader
+	scanner  *bufio.Scanner
+	embl     bool
+	line     int
+	features []*annot.Feature
+}
+
+func newFlatFileReader(fh *xopen.Reader, embl bool) *flatFileReader {
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 1<<16), 1<<30)
+	return &flatFileReader{fh: fh, scanner: scanner, embl: embl}
+}
+
+func (r *flatFileReader) Close() { r.fh.Close() }
+
+func (r *flatFileReader) Features() []*annot.Feature { return r.features }
+
+// flatRecord accumulates the parts of a record.
+type flatRecord struct {
+	locus     string // GenBank LOCUS name or EMBL ID
+	accession string
+	version   string
+	desc      []string
+	circular  bool
+	features  []*rawFeature
+	seq       []byte
+}
+
+// rawFeature is a feature table entry: its key, and its location and
+// qualifiers as they appear on the following lines.
+type rawFeature struct {
+	key   string
+	lines []string
+}
+
+func (r *flatFileReader) errorf(format string, args ...interface{}) error {
+	kind := "GenBank"
+	if r.embl {
+		kind = "EMBL"
+	}
+	return fmt.Errorf("seqfile: %s line %d: %s", kind, r.line, fmt.Sprintf(format, args...))
+}
+
+func (r *flatFileReader) Read() (*fastx.Record, error) {
+	var rec *flatRecord
+	var section string
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimRight(r.scanner.Text(), "\r")
+		if rec == nil {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			rec = &flatRecord{}
+		}
+		if strings.HasPrefix(line, "//") {
+			return r.record(rec)
+		}
+
+		// key is the GenBank keyword or EMBL line code, and text the rest
+		// of the line. Lines continuing a GenBank keyword have no key.
+		var key, text string
+		if r.embl {
+			if len(line) < 2 {
+				continue
+			}
+			key = line[:2]
+			if len(line) > 5 {
+				text = line[5:]
+			}
+			switch key {
+			case "FT":
+				section = "FEATURES"
+				text = "     " + text
+			case "SQ":
+				section = "ORIGIN"
+				continue
+			case "  ":
+				// Sequence lines have no code.
+			default:
+				section = key
+			}
+		} else {
+			switch {
+			case line == "":
+				continue
+			case line[0] != ' ':
+				key = strings.TrimSpace(line[:min(len(line), 12)])
+				if len(line) > 12 {
+					text = line[12:]
+				}
+				section = key
+				if key == "FEATURES" || key == "ORIGIN" {
+					continue
+				}
+			case section == "FEATURES" || section == "ORIGIN":
+				text = line
+			default:
+				// A continuation line, or a sub-keyword such as ORGANISM.
+				if len(line) > 12 {
+					key, text = strings.TrimSpace(line[:12]), line[12:]
+				}
+				if key != "" {
+					section = key
+				}
+			}
+		}
+
+		switch section {
+		case "LOCUS":
+			if fields := strings.Fields(text); len(fields) > 0 && key != "" {
+				rec.locus = fields[0]
+				rec.circular = slices.Contains(fields, "circular")
+			}
+		case "ID":
+			// ID   X56734; SV 1; linear; mRNA; STD; PLN; 1859 BP.
+			fields := strings.Split(text, ";")
+			rec.locus = strings.TrimSpace(fields[0])
+			rec.circular = len(fields) > 2 && strings.TrimSpace(fields[2]) == "circular"
+			if len(fields) > 1 {
+				if sv := strings.TrimSpace(fields[1]); strings.HasPrefix(sv, "SV ") {
+					rec.version = rec.locus + "." + strings.TrimSpace(sv[3:])
+				}
+			}
+		case "ACCESSION", "AC":
+			if fields := strings.FieldsFunc(text, func(c rune) bool { return c == ' ' || c == ';' }); len(fields) > 0 && rec.accession == "" {
+				rec.accession = fields[0]
+			}
+		case "VERSION":
+			if fields := strings.Fields(text); len(fields) > 0 && rec.version == "" {
+				rec.version = fields[0]
+			}
+		case "DEFINITION", "DE":
+			rec.desc = append(rec.desc, strings.TrimSpace(text))
+		case "FEATURES":
+			if len(text) < 21 {
+				continue
+			}
+			if k := strings.TrimSpace(text[:21]); k != "" {
+				rec.features = append(rec.features, &rawFeature{key: k})
+			}
+			text = text[21:]
+			if len(rec.features) == 0 {
+				return nil, r.errorf("qualifier before any feature")
+			}
+			f := rec.features[len(rec.features)-1]
+			f.lines = append(f.lines, strings.TrimSpace(text))
+		case "ORIGIN":
+			for i := 0; i < len(text); i++ {
+				if c := text[i]; ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c == '*' || c == '-' {
+					rec.seq = append(rec.seq, c)
+				}
+			}
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if rec != nil {
+		return nil, r.errorf("record not terminated by //")
+	}
+	return nil, io.EOF
+}
+
+// record makes the fastx record and features of a complete flat file
+// record. Sequences are upper-cased since flat files use lower case for all
+// bases rather than to mark repeats.
+func (r *flatFileReader) record(rec *flatRecord) (*fastx.Record, error) {
+	id := rec.version
+	if id == "" {
+		id = rec.accession
+	}
+	if id == "" {
+		id = rec.locus
+	}
+	if id == "" {
+		return nil, r.errorf("record has no name")
+	}
+	name := id
+	if desc := strings.Join(rec.desc, " "); desc != "" {
+		name += " " + desc
+	}
+
+	source := "GenBank"
+	if r.embl {
+		source = "EMBL"
+	}
+	r.features = nil
+	for i, raw := range rec.features {
+		f, err := raw.parse(id, source, rec)
+		if err != nil {
+			return nil, fmt.Errorf("seqfile: %s record %s, feature %d (%s): %v", source, id, i+1, raw.key, err)
+		}
+		if f == nil {
+			continue
+		}
+		if len(f.Blocks) > 1 {
+			if _, ok := f.Attr("ID"); !ok {
+				// Lines of features with several blocks are tied by their ID.
+				f.Attrs = append([]annot.Attr{{Key: "ID", Value: fmt.Sprintf("%s_%s%d", id, f.Type, i+1)}}, f.Attrs...)
+			}
+		}
+		r.features = append(r.features, f)
+	}
+	return newRecord([]byte(name), bytes.ToUpper(rec.seq), nil)
+}
+
+// parse parses the location and qualifiers of a feature of rec. It returns nil
+// for features located only on other records.
+//
+// Blocks are kept in the order of the location, read backwards on the minus
+// strand, which is genomic order unless the feature spans the origin of a
+// circular sequence or is trans-spliced. As in GFF3, blocks past the origin
+// are shifted by the length of the sequence, ending after it.
+func (raw *rawFeature) parse(seqID, source string, rec *flatRecord) (*annot.Feature, error) {
+	// The location runs until the first qualifier.
+	var loc strings.Builder
+	i := 0
+	for ; i < len(raw.lines) && !strings.HasPrefix(raw.lines[i], "/"); i++ {
+		loc.WriteString(raw.lines[i])
+	}
+	parts, err := parseLocation(strings.ReplaceAll(loc.String(), " ", ""), false)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	f := &annot.Feature{Seq: seqID, Source: source, Type: raw.key, Phase: -1}
+	if f.Type == "source" {
+		f.Type = "region"
+		if rec.circular {
+			f.Attrs = append(f.Attrs, annot.Attr{Key: "Is_circular", Value: "true"})
+		}
+	}
+	f.Strand = parts[0].strand
+	for _, p := range parts {
+		if p.strand != f.Strand {
+			f.Strand = '.'
+		}
+		f.Blocks = append(f.Blocks, p.Block)
+	}
+	if f.Strand == '-' {
+		slices.Reverse(f.Blocks)
+	}
+	if wraps := wrapPoint(f.Blocks); wraps > 0 && rec.circular && len(rec.seq) > 0 &&
+		wrapPoint(f.Blocks[wraps:]) < 0 && f.Blocks[len(f.Blocks)-1].End <= f.Blocks[0].Start {
+		for i := wraps; i < len(f.Blocks); i++ {
+			f.Blocks[i].Start += int64(len(rec.seq))
+			f.Blocks[i].End += int64(len(rec.seq))
+		}
+	}
+	f.Start, f.End = f.Blocks[0].Start, f.Blocks[0].End
+	for _, b := range f.Blocks {
+		f.Start, f.End = min(f.Start, b.Start), max(f.End, b.End)
+	}
+	if len(f.Blocks) == 1 {
+		f.Blocks = nil
+	}
+
+	// Qualifiers start with '/' and may continue over several lines, quoted
+	// values possibly containing lines that start with '/' themselves.
+	var quals []string
+	for ; i < len(raw.lines); i++ {
+		line := raw.lines[i]
+		if n := len(quals); n > 0 && (!strings.HasPrefix(line, "/") || strings.Count(quals[n-1], `"`)%2 == 1) {
+			sep := " "
+			if strings.HasPrefix(quals[n-1], "/translation=") {
+				sep = ""
+			}
+			quals[n-1] += sep + line
+			continue
+		}
+		quals = append(quals, line)
+	}
+	for _, q := range quals {
+		key, value, ok := strings.Cut(q[1:], "=")
+		if !ok {
+			// A flag such as /pseudo.
+			value = "true"
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = strings.ReplaceAll(value[1:len(value)-1], `""`, `"`)
+		}
+		f.Attrs = append(f.Attrs, annot.Attr{Key: key, Value: value})
+		if key == "codon_start" && f.Type == "CDS" {
+			if n, err := strconv.Atoi(value); err == nil && 1 <= n && n <= 3 {
+				f.Phase = n - 1
+			}
+		}
+	}
+	if f.Type == "CDS" && f.Phase < 0 {
+		f.Phase = 0
+	}
+	return f, nil
+}
+
+// wrapPoint returns the index of the first block that starts before the end
+// of the one before it, or -1 if blocks are in genomic order.
+func wrapPoint(blocks []annot.Block) int {
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i].Start < blocks[i-1].End {
+			return i
+		}
+	}
+	return -1
+}
+
+// locPart is a part of a feature location.
+type locPart struct {
+	annot.Block
+	strand byte
+}
+
+// parseLocation parses an INSDC feature location such as
+// "complement(join(<1..206,300..>400))" into its parts. Parts on other
+// records (e.g. "J00194.1:100..202") are left out.
+func parseLocation(s string, minus bool) ([]locPart, error) {
+	for _, op := range []string{"complement(", "join(", "order("} {
+		if !strings.HasPrefix(s, op) {
+			continue
+		}
+		if !strings.HasSuffix(s, ")") {
+			return nil, fmt.Errorf("bad location %q", s)
+		}
+		inner := s[len(op) : len(s)-1]
+		if op == "complement(" {
+			parts, err := parseLocation(inner, !minus)
+			// The parts of a complemented join are in reverse order.
+			for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+				parts[i], parts[j] = parts[j], parts[i]
+			}
+			return parts, err
+		}
+		var parts []locPart
+		depth, start := 0, 0
+		for i := 0; i <= len(inner); i++ {
+			if i < len(inner) {
+				switch inner[i] {
+				case '(':
+					depth++
+					continue
+				case ')':
+					depth--
+					continue
+				case ',':
+					if depth > 0 {
+						continue
+					}
+				default:
+					continue
+				}
+			}
+			p, err := parseLocation(inner[start:i], minus)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, p...)
+			start = i + 1
+		}
+		return parts, nil
+	}
+
+	if strings.Contains(s, ":") {
+		return nil, nil
+	}
+	strand := byte('+')
+	if minus {
+		strand = '-'
+	}
+	from, to, ok := strings.Cut(s, "..")
+	if !ok {
+		// A single base, or a site between two bases (e.g. 123^124),
+		// taken as the first.
+		from, _, _ = strings.Cut(s, "^")
+		to = from
+	}
+	start, err1 := parseLocationPos(from)
+	end, err2 := parseLocationPos(to)
+	if err1 != nil || err2 != nil || start < 1 || end < start {
+		return nil, fmt.Errorf("bad location %q", s)
+	}
+	return []locPart{{annot.Block{Start: start - 1, End: end}, strand}}, nil
+}
+
+// parseLocationPos parses a position, ignoring the '<' and '>' marking
+// partial features and taking the first position of an old-style uncertain
+// "(102.110)".
+func parseLocationPos(s string) (int64, error) {
+	s = strings.Trim(s, "<>()")
+	s, _, _ = strings.Cut(s, ".")
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,66 @@
+package seqfile
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// jsonRecord is a record as a JSON object. Qual is omitted for FASTA.
+type jsonRecord struct {
+	Name string  `json:"name"`
+	Seq  string  `json:"seq"`
+	Qual *string `json:"qual,omitempty"`
+}
+
+// jsonlReader reads a stream of JSON objects, normally one per line.
+type jsonlReader struct {
+	fh      *xopen.Reader
+	decoder *json.Decoder
+	n       int
+}
+
+func newJSONLReader(fh *xopen.Reader) *jsonlReader {
+	return &jsonlReader{fh: fh, decoder: json.NewDecoder(fh)}
+}
+
+func (r *jsonlReader) Read() (*fastx.Record, error) {
+	var jr jsonRecord
+	if err := r.decoder.Decode(&jr); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			err = fmt.Errorf("seqfile: JSON record %d: %v", r.n+1, err)
+		}
+		return nil, err
+	}
+	r.n++
+	var q []byte
+	if jr.Qual != nil {
+		q = []byte(*jr.Qual)
+	}
+	return newRecord([]byte(jr.Name), []byte(jr.Seq), q)
+}
+
+func (r *jsonlReader) Close() { r.fh.Close() }
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func newJSONLWriter(w *xopen.Writer) *jsonlWriter {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &jsonlWriter{encoder: encoder}
+}
+
+func (w *jsonlWriter) Write(rec *fastx.Record) error {
+	jr := jsonRecord{Name: string(rec.Name), Seq: string(rec.Seq.Seq)}
+	if len(rec.Seq.Qual) > 0 {
+		q := string(rec.Seq.Qual)
+		jr.Qual = &q
+	}
+	return w.encoder.Encode(&jr)
+}
+
+func (w *jsonlWriter) Close() error { return nil }
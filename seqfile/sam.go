@@ -0,0 +1,186 @@
+package seqfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/eernst/catseq/seqmath"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// SAM flag bits.
+const (
+	flagPaired        = 0x1
+	flagUnmapped      = 0x4
+	flagMateUnmapped  = 0x8
+	flagReverse       = 0x10
+	flagRead1         = 0x40
+	flagRead2         = 0x80
+	flagSecondary     = 0x100
+	flagSupplementary = 0x800
+)
+
+// SAMTags lists the tags of SAM and BAM records, such as the read group (RG)
+// and barcode (BC), that are carried into record descriptions as they appear
+// in SAM, e.g. "RG:Z:lane1", and back into tags when writing SAM or BAM.
+var SAMTags = []string{"RG", "BC"}
+
+// carriedTag reports whether a SAM tag is one of SAMTags.
+func carriedTag(tag []byte) bool {
+	if len(tag) < 5 || tag[2] != ':' || tag[4] != ':' {
+		return false
+	}
+	for _, t := range SAMTags {
+		if string(tag[:2]) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// samReader reads the reads of a SAM file, in their original orientation.
+// Secondary and supplementary alignments, which repeat reads, are skipped,
+// and "/1" or "/2" is appended to the names of paired reads. A comment in a
+// CO tag and the tags in SAMTags become the description.
+type samReader struct {
+	fh      *xopen.Reader
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newSAMReader(fh *xopen.Reader) *samReader {
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 1<<16), 1<<30)
+	return &samReader{fh: fh, scanner: scanner}
+}
+
+func (r *samReader) Read() (*fastx.Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimRight(r.scanner.Bytes(), "\r")
+		if len(line) == 0 || line[0] == '@' {
+			continue
+		}
+		fields := bytes.Split(line, []byte{'\t'})
+		if len(fields) < 11 {
+			return nil, fmt.Errorf("seqfile: SAM line %d: expected at least 11 tab-separated columns, found %d", r.line, len(fields))
+		}
+		flag, err := strconv.ParseUint(string(fields[1]), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("seqfile: SAM line %d: bad flag %q", r.line, fields[1])
+		}
+		if flag&(flagSecondary|flagSupplementary) != 0 {
+			continue
+		}
+
+		var seq, qual []byte
+		if !bytes.Equal(fields[9], []byte("*")) {
+			seq = append([]byte(nil), fields[9]...)
+		}
+		if !bytes.Equal(fields[10], []byte("*")) {
+			qual = append([]byte(nil), fields[10]...)
+		}
+		return samRecord(fields[0], flag, seq, qual, fields[11:])
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *samReader) Close() { r.fh.Close() }
+
+// samRecord makes a record of a read from a SAM or BAM file, given its
+// sequence and qualities as stored, which it may modify.
+func samRecord(qname []byte, flag uint64, s, q []byte, tags [][]byte) (*fastx.Record, error) {
+	name := append([]byte(nil), qname...)
+	if flag&flagPaired != 0 {
+		switch {
+		case flag&flagRead1 != 0:
+			name = append(name, "/1"...)
+		case flag&flagRead2 != 0:
+			name = append(name, "/2"...)
+		}
+	}
+	for _, tag := range tags {
+		switch {
+		case bytes.HasPrefix(tag, []byte("CO:Z:")):
+			name = append(append(name, ' '), tag[5:]...)
+		case carriedTag(tag):
+			name = append(append(name, ' '), tag...)
+		}
+	}
+	if flag&flagReverse != 0 {
+		s = seqmath.ReverseComplement(s, false)
+		seqmath.Reverse(q)
+	}
+	return newRecord(name, s, q)
+}
+
+// samFields returns the read name, flag and tags under which a record is
+// written as an unaligned read. Names ending in "/1" or "/2" are taken to be
+// of paired reads, and words of the description that are valid tags of
+// SAMTags become tags, the rest a CO tag.
+func samFields(rec *fastx.Record) (qname []byte, flag int, tags [][]byte) {
+	qname, flag = rec.ID, flagUnmapped
+	switch {
+	case bytes.HasSuffix(qname, []byte("/1")):
+		qname, flag = qname[:len(qname)-2], flag|flagPaired|flagMateUnmapped|flagRead1
+	case bytes.HasSuffix(qname, []byte("/2")):
+		qname, flag = qname[:len(qname)-2], flag|flagPaired|flagMateUnmapped|flagRead2
+	}
+	var comment [][]byte
+	for _, word := range bytes.Fields(rec.Name[len(rec.ID):]) {
+		if _, err := appendBAMTag(nil, word); err == nil && carriedTag(word) {
+			tags = append(tags, word)
+		} else {
+			comment = append(comment, word)
+		}
+	}
+	if len(comment) > 0 {
+		tags = append(tags, append([]byte("CO:Z:"), bytes.Join(comment, []byte{' '})...))
+	}
+	return qname, flag, tags
+}
+
+// samWriter writes records as unaligned reads, with their descriptions in
+// tags as given by samFields.
+type samWriter struct {
+	w       *xopen.Writer
+	started bool
+}
+
+func (w *samWriter) header() {
+	if !w.started {
+		w.w.WriteString("@HD\tVN:1.6\tSO:unknown\n")
+		w.started = true
+	}
+}
+
+func (w *samWriter) Write(rec *fastx.Record) error {
+	w.header()
+	qname, flag, tags := samFields(rec)
+	s, q := rec.Seq.Seq, rec.Seq.Qual
+	if len(s) == 0 {
+		s = []byte("*")
+	}
+	if len(q) == 0 {
+		q = []byte("*")
+	}
+	fmt.Fprintf(w.w, "%s\t%d\t*\t0\t0\t*\t*\t0\t0\t%s\t%s", qname, flag, s, q)
+	for _, tag := range tags {
+		w.w.WriteByte('\t')
+		w.w.Write(tag)
+	}
+	return w.w.WriteByte('\n')
+}
+
+func (w *samWriter) Close() error {
+	w.header()
+	return nil
+}
@@ -0,0 +1,253 @@
+// Package seqfile reads and writes sequence records in the file formats catseq
+// supports, as fastx records, so that commands need not care whether their
+// input is FASTA, FASTQ or one of the other formats.
+package seqfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/eernst/catseq/twobit"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// Supported formats.
+const (
+	FASTA  = "fasta"
+	FASTQ  = "fastq"
+	TSV    = "tsv"   // name, sequence and optionally quality columns
+	JSONL  = "jsonl" // one {"name", "seq", "qual"} object per line
+	SAM    = "sam"   // unaligned reads
+	BAM    = "bam"   // unaligned reads
+	TWOBIT = "2bit"  // UCSC 2bit, keeping IDs and soft-masking
+
+	// Annotated sequences, which can only be read.
+	GENBANK = "genbank"
+	EMBL    = "embl"
+)
+
+// InputFormats lists the formats that can be read, and OutputFormats those
+// that can be written.
+var (
+	InputFormats  = []string{FASTA, FASTQ, TSV, JSONL, SAM, BAM, TWOBIT, GENBANK, EMBL}
+	OutputFormats = []string{FASTA, FASTQ, TSV, JSONL, SAM, BAM, TWOBIT}
+)
+
+// Reader reads records one at a time. As with fastx.Reader, a record may be
+// reused by the next call to Read, so callers keeping records must clone
+// them.
+type Reader interface {
+	Read() (*fastx.Record, error)
+	Close()
+}
+
+// Writer writes records in some format. Close finishes the output, e.g.
+// writing the header of an empty SAM file, but doesn't close the underlying
+// writer.
+type Writer interface {
+	Write(rec *fastx.Record) error
+	Close() error
+}
+
+// compressionExts are the compression extensions xopen recognizes.
+var compressionExts = []string{".gz", ".xz", ".zst", ".bz2"}
+
+var formatsByExt = map[string]string{
+	".fasta": FASTA, ".fa": FASTA, ".fna": FASTA, ".faa": FASTA,
+	".fastq": FASTQ, ".fq": FASTQ,
+	".tsv": TSV, ".tab": TSV,
+	".jsonl": JSONL, ".ndjson": JSONL, ".json": JSONL,
+	".sam": SAM, ".bam": BAM,
+	".2bit": TWOBIT,
+	".gb":   GENBANK, ".gbk": GENBANK, ".gbff": GENBANK, ".genbank": GENBANK,
+	".embl": EMBL,
+}
+
+// FormatOf guesses the format of a file from its extension, ignoring any
+// compression extension, e.g. FASTQ for "reads.fq.gz". It returns "" if the
+// extension is unknown.
+func FormatOf(fileName string) string {
+	name := strings.ToLower(fileName)
+	for _, ext := range compressionExts {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return formatsByExt[filepath.Ext(name)]
+}
+
+// samHeaderTags are the record types of SAM header lines, which tell SAM
+// from FASTQ since both start with '@'.
+var samHeaderTags = []string{"@HD\t", "@SQ\t", "@RG\t", "@PG\t", "@CO\t"}
+
+// Sniff guesses the format of a stream from its first line, without
+// consuming it, or for BAM (after decompression) and 2bit from their magic
+// numbers. Empty input is taken to be FASTA.
+func Sniff(r *bufio.Reader) (string, error) {
+	head, err := r.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+	if twobit.IsTwoBit(head) {
+		return TWOBIT, nil
+	}
+	head = bytes.TrimLeft(head, " \t\r\n")
+	line := head
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	switch {
+	case bytes.HasPrefix(head, bamMagic):
+		return BAM, nil
+	case len(head) == 0, head[0] == '>':
+		return FASTA, nil
+	case head[0] == '{':
+		return JSONL, nil
+	case bytes.HasPrefix(head, []byte("LOCUS ")):
+		return GENBANK, nil
+	case bytes.HasPrefix(head, []byte("ID   ")):
+		return EMBL, nil
+	case head[0] == '@':
+		for _, tag := range samHeaderTags {
+			if bytes.HasPrefix(line, []byte(tag)) {
+				return SAM, nil
+			}
+		}
+		return FASTQ, nil
+	case bytes.Count(line, []byte{'\t'}) >= 10:
+		return SAM, nil
+	case bytes.IndexByte(line, '\t') >= 0:
+		return TSV, nil
+	}
+	return "", fmt.Errorf("seqfile: unrecognized sequence format")
+}
+
+// NewReader opens a file ("-" for STDIN), possibly compressed, in the given
+// format, or if format is "", in the format given by its extension or else
+// by its contents.
+func NewReader(fileName, format string) (Reader, error) {
+	if format == "" {
+		format = FormatOf(fileName)
+	}
+	switch format {
+	case BAM:
+		return openBAM(fileName)
+	case TWOBIT:
+		return openTwoBit(fileName)
+	}
+	fh, err := xopen.Ropen(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		if format, err = Sniff(fh.Reader); err != nil {
+			fh.Close()
+			return nil, fmt.Errorf("%v: %s", err, fileName)
+		}
+	}
+	switch format {
+	case FASTA, FASTQ:
+		r, err := fastx.NewReaderFromIO(nil, fh, "")
+		if err != nil {
+			fh.Close()
+			return nil, err
+		}
+		return &fastxReader{Reader: r, fh: fh}, nil
+	case TSV:
+		return newTSVReader(fh), nil
+	case JSONL:
+		return newJSONLReader(fh), nil
+	case SAM:
+		return newSAMReader(fh), nil
+	case BAM:
+		// Sniffed from decompressed input.
+		r, err := newBAMReader(fh, func() { fh.Close() })
+		if err != nil {
+			fh.Close()
+			return nil, fmt.Errorf("%v: %s", err, fileName)
+		}
+		return r, nil
+	case TWOBIT:
+		return readTwoBit(fh, fileName)
+	case GENBANK, EMBL:
+		return newFlatFileReader(fh, format == EMBL), nil
+	}
+	fh.Close()
+	return nil, fmt.Errorf("seqfile: unknown format %q", format)
+}
+
+// fastxReader closes the file behind a fastx.Reader created from it.
+type fastxReader struct {
+	*fastx.Reader
+	fh *xopen.Reader
+}
+
+func (r *fastxReader) Close() {
+	r.Reader.Close()
+	r.fh.Close()
+}
+
+// NewWriter returns a writer of records in the given format. FASTA sequences
+// are wrapped at width bases, unless width is 0.
+func NewWriter(w *xopen.Writer, format string, width int) (Writer, error) {
+	switch format {
+	case FASTA, FASTQ:
+		return &fastxWriter{w: w, fastq: format == FASTQ, width: width}, nil
+	case TSV:
+		return &tsvWriter{w: w}, nil
+	case JSONL:
+		return newJSONLWriter(w), nil
+	case SAM:
+		return &samWriter{w: w}, nil
+	case BAM:
+		return newBAMWriter(w), nil
+	case TWOBIT:
+		return &twoBitWriter{w: twobit.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("seqfile: unknown format %q", format)
+}
+
+// fastxWriter writes FASTA, dropping any qualities, or FASTQ, requiring them.
+type fastxWriter struct {
+	w     *xopen.Writer
+	fastq bool
+	width int
+}
+
+func (w *fastxWriter) Write(rec *fastx.Record) error {
+	if w.fastq && len(rec.Seq.Qual) != len(rec.Seq.Seq) {
+		return fmt.Errorf("seqfile: record %s has no qualities for FASTQ", rec.ID)
+	}
+	if !w.fastq && len(rec.Seq.Qual) > 0 {
+		s := *rec.Seq
+		s.Qual = nil
+		r := *rec
+		r.Seq = &s
+		rec = &r
+	}
+	rec.FormatToWriter(w.w, w.width)
+	return nil
+}
+
+func (w *fastxWriter) Close() error { return nil }
+
+// newRecord makes a record from a header line, sequence and qualities,
+// which may be nil.
+func newRecord(name, s, q []byte) (*fastx.Record, error) {
+	id, desc := name, []byte(nil)
+	if i := bytes.IndexAny(name, " \t"); i >= 0 {
+		id, desc = name[:i], bytes.TrimLeft(name[i:], " \t")
+	}
+	if q == nil {
+		return fastx.NewRecordWithoutValidation(seq.Unlimit, id, name, desc, s)
+	}
+	if len(q) != len(s) {
+		return nil, fmt.Errorf("seqfile: record %s has %d bases but %d qualities", id, len(s), len(q))
+	}
+	return fastx.NewRecordWithQualWithoutValidation(seq.Unlimit, id, name, desc, s, q)
+}
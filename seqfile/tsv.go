@@ -0,0 +1,75 @@
+package seqfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// tsvReader reads lines of a header line, a sequence and optionally
+// qualities, separated by tabs. Blank lines, lines starting with '#' and a
+// first line of column names are skipped.
+type tsvReader struct {
+	fh      *xopen.Reader
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newTSVReader(fh *xopen.Reader) *tsvReader {
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 1<<16), 1<<30)
+	return &tsvReader{fh: fh, scanner: scanner}
+}
+
+var tsvColumnNames = [][]byte{[]byte("name\tseq"), []byte("name\tseq\tqual")}
+
+func (r *tsvReader) Read() (*fastx.Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimRight(r.scanner.Bytes(), "\r")
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if r.line == 1 && (bytes.Equal(line, tsvColumnNames[0]) || bytes.Equal(line, tsvColumnNames[1])) {
+			continue
+		}
+		fields := bytes.Split(line, []byte{'\t'})
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, fmt.Errorf("seqfile: TSV line %d: expected 2 or 3 tab-separated columns, found %d", r.line, len(fields))
+		}
+		var q []byte
+		if len(fields) == 3 {
+			q = append([]byte(nil), fields[2]...)
+		}
+		return newRecord(append([]byte(nil), fields[0]...), append([]byte(nil), fields[1]...), q)
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *tsvReader) Close() { r.fh.Close() }
+
+// tsvWriter writes the header line, sequence and any qualities of each
+// record on one line. Tabs in header lines are replaced by spaces.
+type tsvWriter struct {
+	w *xopen.Writer
+}
+
+func (w *tsvWriter) Write(rec *fastx.Record) error {
+	w.w.Write(bytes.ReplaceAll(rec.Name, []byte{'\t'}, []byte{' '}))
+	w.w.WriteByte('\t')
+	w.w.Write(rec.Seq.Seq)
+	if len(rec.Seq.Qual) > 0 {
+		w.w.WriteByte('\t')
+		w.w.Write(rec.Seq.Qual)
+	}
+	return w.w.WriteByte('\n')
+}
+
+func (w *tsvWriter) Close() error { return nil }
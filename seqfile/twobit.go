@@ -0,0 +1,89 @@
+package seqfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/eernst/catseq/twobit"
+
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+)
+
+// twoBitReader reads the sequences of a 2bit file one at a time, in index
+// order, keeping their soft-masking.
+type twoBitReader struct {
+	f     *twobit.File
+	next  int
+	close func()
+}
+
+// openTwoBit opens a 2bit file for reading its sequences in turn. Files that
+// can't be read at random, such as STDIN or compressed files, are read into
+// memory.
+func openTwoBit(fileName string) (*twoBitReader, error) {
+	if fileName != "-" {
+		fh, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		header := make([]byte, 4)
+		if _, err := fh.ReadAt(header, 0); err == nil && twobit.IsTwoBit(header) {
+			f, err := twobit.NewFile(fh)
+			if err != nil {
+				fh.Close()
+				return nil, fmt.Errorf("%v: %s", err, fileName)
+			}
+			return &twoBitReader{f: f, close: func() { fh.Close() }}, nil
+		}
+		fh.Close()
+	}
+	fh, err := xopen.Ropen(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return readTwoBit(fh, fileName)
+}
+
+// readTwoBit reads a whole 2bit file into memory.
+func readTwoBit(fh *xopen.Reader, fileName string) (*twoBitReader, error) {
+	defer fh.Close()
+	data, err := io.ReadAll(fh)
+	if err != nil {
+		return nil, err
+	}
+	f, err := twobit.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, fileName)
+	}
+	return &twoBitReader{f: f, close: func() {}}, nil
+}
+
+func (r *twoBitReader) Read() (*fastx.Record, error) {
+	if r.next == len(r.f.Seqs) {
+		return nil, io.EOF
+	}
+	s := r.f.Seqs[r.next]
+	r.next++
+	bases, err := r.f.Fetch(s.Name, 0, s.Length)
+	if err != nil {
+		return nil, err
+	}
+	return newRecord([]byte(s.Name), bases, nil)
+}
+
+func (r *twoBitReader) Close() { r.close() }
+
+// twoBitWriter writes records to a 2bit file, named by their IDs, when
+// closed.
+type twoBitWriter struct {
+	w *twobit.Writer
+}
+
+func (w *twoBitWriter) Write(rec *fastx.Record) error {
+	return w.w.Add(string(rec.ID), rec.Seq.Seq)
+}
+
+func (w *twoBitWriter) Close() error { return w.w.Close() }
@@ -0,0 +1,124 @@
+package seqmatch
+
+// AhoCorasick matches many exact patterns in a single pass over the text,
+// using an Aho-Corasick automaton compiled to a deterministic transition
+// table. Matching ignores case. Match.Pattern is the index of the pattern in
+// the slice given to NewAhoCorasick.
+type AhoCorasick struct {
+	alphabet [256]uint16 // byte to symbol; 0 for bytes in no pattern
+	symbols  int
+	delta    []int32 // delta[state*symbols+symbol] is the next state
+	outputs  [][]int32
+	lengths  []int
+}
+
+// NewAhoCorasick builds an automaton for the given patterns.
+func NewAhoCorasick(patterns [][]byte) *AhoCorasick {
+	ac := &AhoCorasick{lengths: make([]int, len(patterns))}
+
+	// Symbol 0 stands for all bytes not occurring in any pattern.
+	ac.symbols = 1
+	for _, p := range patterns {
+		for _, c := range p {
+			u := upper(c)
+			if ac.alphabet[u] == 0 {
+				ac.alphabet[u] = uint16(ac.symbols)
+				ac.symbols++
+			}
+		}
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		ac.alphabet[c] = ac.alphabet[c-'a'+'A']
+	}
+
+	// Build the trie, with -1 for missing edges.
+	newState := func() int32 {
+		for i := 0; i < ac.symbols; i++ {
+			ac.delta = append(ac.delta, -1)
+		}
+		ac.outputs = append(ac.outputs, nil)
+		return int32(len(ac.outputs) - 1)
+	}
+	newState()
+	for i, p := range patterns {
+		ac.lengths[i] = len(p)
+		var state int32
+		for _, c := range p {
+			edge := int(state)*ac.symbols + int(ac.alphabet[upper(c)])
+			if ac.delta[edge] < 0 {
+				next := newState()
+				ac.delta[edge] = next
+			}
+			state = ac.delta[edge]
+		}
+		ac.outputs[state] = append(ac.outputs[state], int32(i))
+	}
+
+	// Breadth-first, fill in failure transitions so every state has an edge
+	// for every symbol, and inherit the outputs of each state's failure state.
+	fail := make([]int32, len(ac.outputs))
+	queue := make([]int32, 0, len(ac.outputs))
+	for sym := 0; sym < ac.symbols; sym++ {
+		next := ac.delta[sym]
+		if next < 0 {
+			ac.delta[sym] = 0
+		} else {
+			fail[next] = 0
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		ac.outputs[state] = append(ac.outputs[state], ac.outputs[fail[state]]...)
+		for sym := 0; sym < ac.symbols; sym++ {
+			edge := int(state)*ac.symbols + sym
+			next := ac.delta[edge]
+			failNext := ac.delta[int(fail[state])*ac.symbols+sym]
+			if next < 0 {
+				ac.delta[edge] = failNext
+			} else {
+				fail[next] = failNext
+				queue = append(queue, next)
+			}
+		}
+	}
+	return ac
+}
+
+// readAs makes the automaton read the text byte c, in either case, as the
+// pattern byte as. It must not be called with a c occurring in a pattern.
+func (ac *AhoCorasick) readAs(c, as byte) {
+	ac.alphabet[upper(c)] = ac.alphabet[upper(as)]
+	ac.alphabet[upper(c)-'A'+'a'] = ac.alphabet[upper(as)]
+}
+
+// scan calls found with each match until it returns false.
+func (ac *AhoCorasick) scan(text []byte, found func(m Match) bool) {
+	var state int32
+	for j, c := range text {
+		state = ac.delta[int(state)*ac.symbols+int(ac.alphabet[c])]
+		for _, p := range ac.outputs[state] {
+			if !found(Match{Start: j + 1 - ac.lengths[p], End: j + 1, Pattern: int(p)}) {
+				return
+			}
+		}
+	}
+}
+
+func (ac *AhoCorasick) Match(text []byte) bool {
+	matched := false
+	ac.scan(text, func(Match) bool {
+		matched = true
+		return false
+	})
+	return matched
+}
+
+func (ac *AhoCorasick) FindAll(dst []Match, text []byte) []Match {
+	ac.scan(text, func(m Match) bool {
+		dst = append(dst, m)
+		return true
+	})
+	return dst
+}
@@ -0,0 +1,262 @@
+package seqmatch
+
+import (
+	"fmt"
+)
+
+// ErrorModel selects which differences an approximate match may contain.
+type ErrorModel int
+
+const (
+	// Exact allows no differences.
+	Exact ErrorModel = iota
+	// Mismatches allows substitutions only (Hamming distance).
+	Mismatches
+	// Edits allows substitutions, insertions and deletions (Levenshtein
+	// distance).
+	Edits
+)
+
+// CompileApprox compiles a motif of IUPAC ambiguity codes that matches with at
+// most k differences of the given kind.
+func CompileApprox(pattern string, alphabet Alphabet, model ErrorModel, k int) (Matcher, error) {
+	classes, err := MotifClasses(pattern, alphabet)
+	if err != nil {
+		return nil, err
+	}
+	if k < 0 {
+		return nil, fmt.Errorf("the number of allowed differences can't be negative")
+	}
+	if model == Exact || k == 0 {
+		return NewMotif(classes), nil
+	}
+	if k >= len(classes) {
+		return nil, fmt.Errorf("allowing %d differences in a motif of length %d would match anything", k, len(classes))
+	}
+	if model == Mismatches {
+		return NewHamming(classes, k), nil
+	}
+	return NewLevenshtein(classes, k), nil
+}
+
+// peq returns the Shift-And/Myers match masks of the first 64 positions.
+func peq(classes []ByteClass) (masks [256]uint64) {
+	for i := 0; i < len(classes) && i < 64; i++ {
+		for c := range classes[i] {
+			if classes[i][c] {
+				masks[c] |= 1 << uint(i)
+			}
+		}
+	}
+	return masks
+}
+
+// Hamming matches a motif with at most K mismatches. Motifs of up to 64
+// positions use the bit-parallel Shift-And algorithm extended with one state
+// vector per allowed mismatch (Wu & Manber); longer motifs are compared
+// position by position.
+type Hamming struct {
+	classes []ByteClass
+	masks   [256]uint64
+	K       int
+}
+
+func NewHamming(classes []ByteClass, k int) *Hamming {
+	return &Hamming{classes: classes, masks: peq(classes), K: k}
+}
+
+// scan calls found with the start and mismatch count of each match until it
+// returns false.
+func (h *Hamming) scan(text []byte, found func(start, mismatches int) bool) {
+	m := len(h.classes)
+	if m > 64 {
+		for start := 0; start+m <= len(text); start++ {
+			mismatches := 0
+			for i := 0; i < m && mismatches <= h.K; i++ {
+				if !h.classes[i][text[start+i]] {
+					mismatches++
+				}
+			}
+			if mismatches <= h.K && !found(start, mismatches) {
+				return
+			}
+		}
+		return
+	}
+
+	last := uint64(1) << uint(m-1)
+	state := make([]uint64, h.K+1)
+	for j, c := range text {
+		mask := h.masks[c]
+		prev := state[0]
+		state[0] = ((state[0] << 1) | 1) & mask
+		for d := 1; d <= h.K; d++ {
+			old := state[d]
+			state[d] = (((old << 1) | 1) & mask) | ((prev << 1) | 1)
+			prev = old
+		}
+		for d := 0; d <= h.K; d++ {
+			if state[d]&last != 0 {
+				if !found(j-m+1, d) {
+					return
+				}
+				break
+			}
+		}
+	}
+}
+
+func (h *Hamming) Match(text []byte) bool {
+	matched := false
+	h.scan(text, func(int, int) bool {
+		matched = true
+		return false
+	})
+	return matched
+}
+
+func (h *Hamming) FindAll(dst []Match, text []byte) []Match {
+	h.scan(text, func(start, mismatches int) bool {
+		dst = append(dst, Match{Start: start, End: start + len(h.classes), Edits: mismatches})
+		return true
+	})
+	return dst
+}
+
+// Levenshtein matches a motif with at most K substitutions, insertions or
+// deletions. Motifs of up to 64 positions use Myers' bit-parallel algorithm;
+// longer motifs fall back to the O(nm) dynamic programming of Sellers.
+//
+// Every text position where an alignment ends gives a hit, so runs of
+// adjacent end positions are collapsed to the one with the fewest edits.
+type Levenshtein struct {
+	classes []ByteClass
+	masks   [256]uint64
+	K       int
+}
+
+func NewLevenshtein(classes []ByteClass, k int) *Levenshtein {
+	return &Levenshtein{classes: classes, masks: peq(classes), K: k}
+}
+
+// scanEnds calls found with each (inclusive) end position at which an
+// alignment with at most K edits ends, and its edit count, until it returns
+// false.
+func (l *Levenshtein) scanEnds(text []byte, found func(end, edits int) bool) {
+	m := len(l.classes)
+	if m > 64 {
+		col := make([]int, m+1)
+		for i := range col {
+			col[i] = i
+		}
+		for j, c := range text {
+			diag := col[0] // col[0] stays 0: alignments may start anywhere
+			for i := 1; i <= m; i++ {
+				cost := 1
+				if l.classes[i-1][c] {
+					cost = 0
+				}
+				next := min(col[i]+1, col[i-1]+1, diag+cost)
+				diag, col[i] = col[i], next
+			}
+			if col[m] <= l.K && !found(j, col[m]) {
+				return
+			}
+		}
+		return
+	}
+
+	last := uint64(1) << uint(m-1)
+	pv, mv := ^uint64(0), uint64(0)
+	score := m
+	for j, c := range text {
+		eq := l.masks[c]
+		xv := eq | mv
+		xh := (((eq & pv) + pv) ^ pv) | eq
+		ph := mv | ^(xh | pv)
+		mh := pv & xh
+		if ph&last != 0 {
+			score++
+		} else if mh&last != 0 {
+			score--
+		}
+		ph <<= 1
+		mh <<= 1
+		pv = mh | ^(xv | ph)
+		mv = ph & xv
+		if score <= l.K && !found(j, score) {
+			return
+		}
+	}
+}
+
+func (l *Levenshtein) Match(text []byte) bool {
+	matched := false
+	l.scanEnds(text, func(int, int) bool {
+		matched = true
+		return false
+	})
+	return matched
+}
+
+func (l *Levenshtein) FindAll(dst []Match, text []byte) []Match {
+	bestEnd, bestEdits, runEnd := -1, 0, -2
+	flush := func() {
+		if bestEnd >= 0 {
+			start, edits := l.start(text, bestEnd)
+			dst = append(dst, Match{Start: start, End: bestEnd + 1, Edits: edits})
+		}
+	}
+	l.scanEnds(text, func(end, edits int) bool {
+		if end != runEnd+1 {
+			flush()
+			bestEnd, bestEdits = end, edits
+		} else if edits < bestEdits {
+			bestEnd, bestEdits = end, edits
+		}
+		runEnd = end
+		return true
+	})
+	flush()
+	return dst
+}
+
+// start finds where the best alignment ending at end (inclusive) begins, by
+// aligning the reversed motif against the text leading up to end.
+func (l *Levenshtein) start(text []byte, end int) (start, edits int) {
+	m := len(l.classes)
+	maxLen := min(m+l.K, end+1)
+	// row[t] is the distance between the motif suffix processed so far and
+	// the t text bytes ending at end.
+	row := make([]int, maxLen+1)
+	for t := range row {
+		row[t] = t
+	}
+	for i := m - 1; i >= 0; i-- {
+		diag := row[0]
+		row[0] = m - i
+		for t := 1; t <= maxLen; t++ {
+			cost := 1
+			if l.classes[i][text[end-t+1]] {
+				cost = 0
+			}
+			next := min(row[t]+1, row[t-1]+1, diag+cost)
+			diag, row[t] = row[t], next
+		}
+	}
+	bestLen, bestEdits := 0, row[0]
+	for t := 1; t <= maxLen; t++ {
+		d := row[t]
+		if d < bestEdits || (d == bestEdits && abs(t-m) < abs(bestLen-m)) {
+			bestLen, bestEdits = t, d
+		}
+	}
+	return end - bestLen + 1, bestEdits
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
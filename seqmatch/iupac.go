@@ -0,0 +1,131 @@
+package seqmatch
+
+import (
+	"fmt"
+)
+
+// Alphabet selects how ambiguity codes in a motif are interpreted.
+type Alphabet int
+
+const (
+	Nucleotide Alphabet = iota
+	Protein
+)
+
+// Bit masks of the nucleotides each IUPAC code stands for.
+const (
+	baseA = 1 << iota
+	baseC
+	baseG
+	baseT
+)
+
+var nucleotideMasks = map[byte]byte{
+	'A': baseA,
+	'C': baseC,
+	'G': baseG,
+	'T': baseT,
+	'U': baseT,
+	'R': baseA | baseG,
+	'Y': baseC | baseT,
+	'S': baseC | baseG,
+	'W': baseA | baseT,
+	'K': baseG | baseT,
+	'M': baseA | baseC,
+	'B': baseC | baseG | baseT,
+	'D': baseA | baseG | baseT,
+	'H': baseA | baseC | baseT,
+	'V': baseA | baseC | baseG,
+	'N': baseA | baseC | baseG | baseT,
+}
+
+// Amino acid ambiguity codes and the residues they stand for.
+var proteinCodes = map[byte]string{
+	'B': "DN",
+	'Z': "EQ",
+	'J': "IL",
+}
+
+// ByteClass is the set of text bytes matched by one motif position.
+type ByteClass [256]bool
+
+// IsMotif reports whether pattern consists only of ambiguity codes of the
+// alphabet, i.e. can be searched as a motif rather than a regular expression.
+func IsMotif(pattern string, alphabet Alphabet) bool {
+	if pattern == "" {
+		return false
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := upper(pattern[i])
+		switch alphabet {
+		case Nucleotide:
+			if nucleotideMasks[c] == 0 {
+				return false
+			}
+		default:
+			if c < 'A' || c > 'Z' {
+				if c != '*' {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// MotifClasses expands each position of a motif into the set of text bytes it
+// matches. Matching ignores case. A nucleotide code matches any code standing
+// for a subset of its bases, so N matches every base and R matches A, G and R.
+// For proteins, B, Z and J match their two residues and X matches any residue.
+func MotifClasses(pattern string, alphabet Alphabet) ([]ByteClass, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty motif")
+	}
+	classes := make([]ByteClass, len(pattern))
+	for i := 0; i < len(pattern); i++ {
+		c := upper(pattern[i])
+		class := &classes[i]
+		switch alphabet {
+		case Nucleotide:
+			mask := nucleotideMasks[c]
+			if mask == 0 {
+				return nil, fmt.Errorf("%q at position %d is not an IUPAC nucleotide code", pattern[i], i+1)
+			}
+			for t, tmask := range nucleotideMasks {
+				if tmask&^mask == 0 {
+					class.add(t)
+				}
+			}
+		default:
+			switch {
+			case c == 'X':
+				for t := byte('A'); t <= 'Z'; t++ {
+					class.add(t)
+				}
+				class.add('*')
+			case c == '*' || (c >= 'A' && c <= 'Z'):
+				class.add(c)
+				for _, r := range []byte(proteinCodes[c]) {
+					class.add(r)
+				}
+			default:
+				return nil, fmt.Errorf("%q at position %d is not an IUPAC amino acid code", pattern[i], i+1)
+			}
+		}
+	}
+	return classes, nil
+}
+
+func (class *ByteClass) add(c byte) {
+	class[c] = true
+	if c >= 'A' && c <= 'Z' {
+		class[c+'a'-'A'] = true
+	}
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
@@ -0,0 +1,151 @@
+// Package seqmatch implements the pattern matching engines behind catseq grep:
+// regular expressions, and IUPAC degenerate motifs matched exactly or with
+// mismatches or edits, on either strand, singly or as large pattern sets.
+package seqmatch
+
+import (
+	"regexp"
+)
+
+// Match is the location of a pattern match in a text. Start and End are
+// 0-based and half-open, always on the plus strand of the text.
+type Match struct {
+	Start   int
+	End     int
+	Minus   bool // matched the reverse complement of the pattern
+	Edits   int  // mismatches or edits of an approximate match
+	Pattern int  // index of the matching pattern, for pattern sets
+}
+
+// Strand returns '+' or '-'.
+func (m Match) Strand() byte {
+	if m.Minus {
+		return '-'
+	}
+	return '+'
+}
+
+// Matcher finds pattern matches in a text. Implementations are safe for
+// concurrent use.
+type Matcher interface {
+	// Match reports whether text contains a match.
+	Match(text []byte) bool
+	// FindAll appends all matches in text to dst, including overlapping
+	// ones where the engine supports them.
+	FindAll(dst []Match, text []byte) []Match
+}
+
+// Regexp adapts a compiled regular expression to the Matcher interface.
+type Regexp struct {
+	*regexp.Regexp
+	// Overlapping makes FindAll restart the search one byte after the start
+	// of each match, rather than at its end. Anchors then match at each
+	// restart position.
+	Overlapping bool
+}
+
+func (r Regexp) FindAll(dst []Match, text []byte) []Match {
+	if !r.Overlapping {
+		for _, loc := range r.FindAllIndex(text, -1) {
+			dst = append(dst, Match{Start: loc[0], End: loc[1]})
+		}
+		return dst
+	}
+	for pos := 0; pos <= len(text); {
+		loc := r.FindIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+		dst = append(dst, Match{Start: pos + loc[0], End: pos + loc[1]})
+		pos += loc[0] + 1
+	}
+	return dst
+}
+
+// Motif matches a fixed-length degenerate motif, with a set of allowed bytes
+// for each position. Motifs of up to 64 positions are searched with the
+// bit-parallel Shift-And algorithm; longer motifs use Shift-And on their first
+// 64 positions to find candidates that are then verified.
+type Motif struct {
+	classes []ByteClass
+	masks   [256]uint64
+	last    uint64 // bit of the last position covered by masks
+}
+
+// CompileMotif compiles a motif of IUPAC ambiguity codes.
+func CompileMotif(pattern string, alphabet Alphabet) (*Motif, error) {
+	classes, err := MotifClasses(pattern, alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return NewMotif(classes), nil
+}
+
+// NewMotif returns a Motif matching the given per-position byte classes.
+func NewMotif(classes []ByteClass) *Motif {
+	m := &Motif{classes: classes}
+	n := min(len(classes), 64)
+	for i := 0; i < n; i++ {
+		for c := range classes[i] {
+			if classes[i][c] {
+				m.masks[c] |= 1 << uint(i)
+			}
+		}
+	}
+	m.last = 1 << uint(n-1)
+	return m
+}
+
+// Len returns the number of positions in the motif.
+func (m *Motif) Len() int {
+	return len(m.classes)
+}
+
+// scan calls found with the start of each match until it returns false.
+func (m *Motif) scan(text []byte, found func(start int) bool) {
+	n := min(len(m.classes), 64)
+	var state uint64
+	for j, c := range text {
+		state = ((state << 1) | 1) & m.masks[c]
+		if state&m.last == 0 {
+			continue
+		}
+		start := j - n + 1
+		if len(m.classes) > 64 && !m.verify(text, start) {
+			continue
+		}
+		if !found(start) {
+			return
+		}
+	}
+}
+
+// verify checks the positions beyond the first 64 of a long motif.
+func (m *Motif) verify(text []byte, start int) bool {
+	if start+len(m.classes) > len(text) {
+		return false
+	}
+	for i := 64; i < len(m.classes); i++ {
+		if !m.classes[i][text[start+i]] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Motif) Match(text []byte) bool {
+	matched := false
+	m.scan(text, func(int) bool {
+		matched = true
+		return false
+	})
+	return matched
+}
+
+func (m *Motif) FindAll(dst []Match, text []byte) []Match {
+	m.scan(text, func(start int) bool {
+		dst = append(dst, Match{Start: start, End: start + len(m.classes)})
+		return true
+	})
+	return dst
+}
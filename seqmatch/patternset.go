@@ -0,0 +1,187 @@
+package seqmatch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CompileMotifSet compiles many motifs into a single matcher whose matches
+// carry the index of the motif in Match.Pattern. Motifs without ambiguity
+// codes matched exactly are combined into one Aho-Corasick automaton, so the
+// text is scanned once whatever the number of motifs; otherwise each motif
+// gets its own matcher. Minus strand matches have Match.Minus set.
+func CompileMotifSet(patterns []string, alphabet Alphabet, strands Strands, model ErrorModel, k int) (Matcher, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no patterns given")
+	}
+	plain := model == Exact || k == 0
+	for _, p := range patterns {
+		if !IsMotif(p, alphabet) {
+			return nil, fmt.Errorf("%q is not a motif of IUPAC codes", p)
+		}
+		if !isUnambiguous(p, alphabet) {
+			plain = false
+		}
+	}
+
+	if plain {
+		set := make([][]byte, 0, 2*len(patterns))
+		if strands&PlusStrand != 0 {
+			for _, p := range patterns {
+				set = append(set, []byte(p))
+			}
+		}
+		if strands&MinusStrand != 0 {
+			for _, p := range patterns {
+				set = append(set, []byte(ReverseComplementMotif(p)))
+			}
+		}
+		ac := NewAhoCorasick(set)
+		if alphabet == Nucleotide {
+			// As with Motif, T in a motif matches U in RNA. Motifs with U
+			// aren't plain, so U never occurs in the automaton's patterns.
+			ac.readAs('U', 'T')
+		}
+		return &motifSet{ac: ac, n: len(patterns), strands: strands}, nil
+	}
+
+	matchers := make([]Matcher, len(patterns))
+	for i, p := range patterns {
+		var plus, minus Matcher
+		var err error
+		if strands&PlusStrand != 0 {
+			if plus, err = CompileApprox(p, alphabet, model, k); err != nil {
+				return nil, fmt.Errorf("pattern %d: %v", i+1, err)
+			}
+		}
+		if strands&MinusStrand != 0 {
+			if minus, err = CompileApprox(ReverseComplementMotif(p), alphabet, model, k); err != nil {
+				return nil, fmt.Errorf("pattern %d: %v", i+1, err)
+			}
+		}
+		matchers[i] = &Stranded{Plus: plus, Minus: minus}
+	}
+	return &matcherSet{matchers: matchers}, nil
+}
+
+func isUnambiguous(p string, alphabet Alphabet) bool {
+	for i := 0; i < len(p); i++ {
+		switch upper(p[i]) {
+		case 'A', 'C', 'G', 'T':
+		case 'U':
+			// Matches T as well as U in nucleotide motifs.
+			if alphabet == Nucleotide {
+				return false
+			}
+		case 'B', 'Z', 'J', 'X':
+			return false
+		default:
+			if alphabet == Nucleotide {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// motifSet adapts an Aho-Corasick automaton built from the plus strand
+// motifs followed by their reverse complements.
+type motifSet struct {
+	ac      *AhoCorasick
+	n       int
+	strands Strands
+}
+
+func (s *motifSet) Match(text []byte) bool {
+	return s.ac.Match(text)
+}
+
+func (s *motifSet) FindAll(dst []Match, text []byte) []Match {
+	start := len(dst)
+	dst = s.ac.FindAll(dst, text)
+	for i := start; i < len(dst); i++ {
+		m := &dst[i]
+		switch {
+		case s.strands == MinusStrand:
+			m.Minus = true
+		case m.Pattern >= s.n:
+			m.Pattern -= s.n
+			m.Minus = true
+		}
+	}
+	return dst
+}
+
+// matcherSet runs one matcher per pattern.
+type matcherSet struct {
+	matchers []Matcher
+}
+
+func (s *matcherSet) Match(text []byte) bool {
+	for _, m := range s.matchers {
+		if m.Match(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *matcherSet) FindAll(dst []Match, text []byte) []Match {
+	for i, m := range s.matchers {
+		start := len(dst)
+		dst = m.FindAll(dst, text)
+		for j := start; j < len(dst); j++ {
+			dst[j].Pattern = i
+		}
+	}
+	return dst
+}
+
+// RegexpSet matches any of several regular expressions, combined into a
+// single alternation so the text is scanned once. Match.Pattern is the index
+// of the expression that matched.
+type RegexpSet struct {
+	re     *regexp.Regexp
+	groups []int // capture group index of each pattern
+}
+
+// CompileRegexpSet compiles the alternation of patterns, prefixing it with
+// flags such as "(?i)".
+func CompileRegexpSet(patterns []string, flags string) (*RegexpSet, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no patterns given")
+	}
+	alternatives := make([]string, len(patterns))
+	for i, p := range patterns {
+		if _, err := regexp.Compile(flags + p); err != nil {
+			return nil, fmt.Errorf("pattern %d: %v", i+1, err)
+		}
+		alternatives[i] = fmt.Sprintf("(?P<catseq_p%d>%s)", i, p)
+	}
+	re, err := regexp.Compile(flags + strings.Join(alternatives, "|"))
+	if err != nil {
+		return nil, err
+	}
+	s := &RegexpSet{re: re, groups: make([]int, len(patterns))}
+	for i := range patterns {
+		s.groups[i] = re.SubexpIndex(fmt.Sprintf("catseq_p%d", i))
+	}
+	return s, nil
+}
+
+func (s *RegexpSet) Match(text []byte) bool {
+	return s.re.Match(text)
+}
+
+func (s *RegexpSet) FindAll(dst []Match, text []byte) []Match {
+	for _, loc := range s.re.FindAllSubmatchIndex(text, -1) {
+		for i, g := range s.groups {
+			if loc[2*g] >= 0 {
+				dst = append(dst, Match{Start: loc[0], End: loc[1], Pattern: i})
+				break
+			}
+		}
+	}
+	return dst
+}
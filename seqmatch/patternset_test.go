@@ -0,0 +1,168 @@
+package seqmatch
+
+import (
+	"slices"
+	"testing"
+)
+
+func sortedMatches(matches []Match) []Match {
+	slices.SortFunc(matches, func(a, b Match) int {
+		if a.Start != b.Start {
+			return a.Start - b.Start
+		}
+		if a.Pattern != b.Pattern {
+			return a.Pattern - b.Pattern
+		}
+		if a.Minus != b.Minus {
+			if a.Minus {
+				return 1
+			}
+			return -1
+		}
+		return a.End - b.End
+	})
+	return matches
+}
+
+func TestCompileMotifSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		alphabet Alphabet
+		strands  Strands
+		model    ErrorModel
+		k        int
+		text     string
+		want     []Match
+	}{
+		{
+			name:     "plus strand",
+			patterns: []string{"CGGTA", "AAAC"},
+			strands:  PlusStrand,
+			text:     "AAACGGTAAAA",
+			want:     []Match{{Start: 0, End: 4, Pattern: 1}, {Start: 3, End: 8}},
+		},
+		{
+			name:     "lower case",
+			patterns: []string{"cggta"},
+			strands:  PlusStrand,
+			text:     "aaaCGgtAaaa",
+			want:     []Match{{Start: 3, End: 8}},
+		},
+		{
+			name:     "RNA",
+			patterns: []string{"CGGTA", "AAAC"},
+			strands:  PlusStrand,
+			text:     "AAACGGUAAAA",
+			want:     []Match{{Start: 0, End: 4, Pattern: 1}, {Start: 3, End: 8}},
+		},
+		{
+			name:     "lower case RNA",
+			patterns: []string{"CGGTA"},
+			strands:  PlusStrand,
+			text:     "aaacggua",
+			want:     []Match{{Start: 3, End: 8}},
+		},
+		{
+			name:     "RNA minus strand",
+			patterns: []string{"TTACCG"},
+			strands:  MinusStrand,
+			text:     "AAACGGUAAAA",
+			want:     []Match{{Start: 3, End: 9, Minus: true}},
+		},
+		{
+			name:     "RNA both strands",
+			patterns: []string{"UUUU", "CGGTA"},
+			strands:  BothStrands,
+			text:     "AAACGGUAAAA",
+			want:     []Match{{Start: 3, End: 8, Pattern: 1}, {Start: 7, End: 11, Minus: true}},
+		},
+		{
+			name:     "protein U isn't T",
+			patterns: []string{"MKT"},
+			alphabet: Protein,
+			strands:  PlusStrand,
+			text:     "MKUMKT",
+			want:     []Match{{Start: 3, End: 6}},
+		},
+		{
+			name:     "ambiguity codes",
+			patterns: []string{"CGNTA", "AAR"},
+			strands:  PlusStrand,
+			text:     "AAACGGUAAAA",
+			want: []Match{
+				{Start: 0, End: 3, Pattern: 1}, {Start: 3, End: 8},
+				{Start: 7, End: 10, Pattern: 1},
+				{Start: 8, End: 11, Pattern: 1},
+			},
+		},
+		{
+			name:     "mismatches",
+			patterns: []string{"CGCTA"},
+			strands:  PlusStrand,
+			model:    Mismatches,
+			k:        1,
+			text:     "AAACGGUAAAA",
+			want:     []Match{{Start: 3, End: 8, Edits: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := CompileMotifSet(tt.patterns, tt.alphabet, tt.strands, tt.model, tt.k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := sortedMatches(m.FindAll(nil, []byte(tt.text)))
+			if !slices.Equal(got, sortedMatches(tt.want)) {
+				t.Errorf("FindAll = %+v, want %+v", got, tt.want)
+			}
+			if matched := m.Match([]byte(tt.text)); matched != (len(tt.want) > 0) {
+				t.Errorf("Match = %v, want %v", matched, !matched)
+			}
+		})
+	}
+}
+
+// A set of plain motifs finds the same matches as its motifs one at a time.
+func TestMotifSetAsMotifs(t *testing.T) {
+	patterns := []string{"ACG", "CGT", "GTTA", "TAAC", "A"}
+	texts := []string{"ACGTTAACGT", "acguuaacgu", "TTTT", "", "NNACGNN"}
+	set, err := CompileMotifSet(patterns, Nucleotide, BothStrands, Exact, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range texts {
+		var want []Match
+		for i, p := range patterns {
+			plus, err := CompileMotif(p, Nucleotide)
+			if err != nil {
+				t.Fatal(err)
+			}
+			minus, err := CompileMotif(ReverseComplementMotif(p), Nucleotide)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := len(want)
+			want = (&Stranded{Plus: plus, Minus: minus}).FindAll(want, []byte(text))
+			for j := start; j < len(want); j++ {
+				want[j].Pattern = i
+			}
+		}
+		got := sortedMatches(set.FindAll(nil, []byte(text)))
+		if !slices.Equal(got, sortedMatches(want)) {
+			t.Errorf("%q: FindAll = %+v, want %+v", text, got, want)
+		}
+	}
+}
+
+func TestCompileMotifSetErrors(t *testing.T) {
+	if _, err := CompileMotifSet(nil, Nucleotide, BothStrands, Exact, 0); err == nil {
+		t.Errorf("CompileMotifSet of no patterns succeeded")
+	}
+	if _, err := CompileMotifSet([]string{"ACGT", "AC-T"}, Nucleotide, BothStrands, Exact, 0); err == nil {
+		t.Errorf("CompileMotifSet of a non-motif succeeded")
+	}
+	if _, err := CompileMotifSet([]string{"ACGT", "AC"}, Nucleotide, PlusStrand, Mismatches, 2); err == nil {
+		t.Errorf("CompileMotifSet allowing as many mismatches as positions succeeded")
+	}
+}
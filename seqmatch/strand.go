@@ -0,0 +1,118 @@
+package seqmatch
+
+import (
+	"fmt"
+
+	"github.com/eernst/catseq/seqmath"
+)
+
+// Strands is a set of strands to search or that matched.
+type Strands int
+
+const (
+	PlusStrand Strands = 1 << iota
+	MinusStrand
+	BothStrands = PlusStrand | MinusStrand
+)
+
+// ParseStrands parses "+", "-" or "both".
+func ParseStrands(s string) (Strands, error) {
+	switch s {
+	case "+":
+		return PlusStrand, nil
+	case "-":
+		return MinusStrand, nil
+	case "both", "+-", "-+":
+		return BothStrands, nil
+	}
+	return 0, fmt.Errorf("unknown strand %q, expected \"+\", \"-\" or \"both\"", s)
+}
+
+func (s Strands) String() string {
+	switch s {
+	case PlusStrand:
+		return "+"
+	case MinusStrand:
+		return "-"
+	case BothStrands:
+		return "+,-"
+	}
+	return ""
+}
+
+// ReverseComplementMotif returns the reverse complement of a nucleotide motif,
+// complementing ambiguity codes (e.g. R becomes Y).
+func ReverseComplementMotif(pattern string) string {
+	rc := make([]byte, len(pattern))
+	for i := 0; i < len(pattern); i++ {
+		rc[len(pattern)-1-i] = complementCode(upper(pattern[i]))
+	}
+	return string(rc)
+}
+
+func complementCode(c byte) byte {
+	if c == 'U' {
+		return 'A'
+	}
+	return seqmath.ComplementBase(c)
+}
+
+// Stranded searches the plus strand with one matcher and the minus strand
+// with another, typically compiled from the reverse complement of the same
+// pattern. Either may be nil to search a single strand. Matches found by Minus
+// have Match.Minus set; their coordinates are still on the plus strand.
+type Stranded struct {
+	Plus  Matcher
+	Minus Matcher
+}
+
+// MatchedStrands returns the strands on which text contains a match.
+func (s *Stranded) MatchedStrands(text []byte) (strands Strands) {
+	if s.Plus != nil && s.Plus.Match(text) {
+		strands |= PlusStrand
+	}
+	if s.Minus != nil && s.Minus.Match(text) {
+		strands |= MinusStrand
+	}
+	return strands
+}
+
+func (s *Stranded) Match(text []byte) bool {
+	return (s.Plus != nil && s.Plus.Match(text)) || (s.Minus != nil && s.Minus.Match(text))
+}
+
+func (s *Stranded) FindAll(dst []Match, text []byte) []Match {
+	if s.Plus != nil {
+		dst = s.Plus.FindAll(dst, text)
+	}
+	if s.Minus != nil {
+		n := len(dst)
+		dst = s.Minus.FindAll(dst, text)
+		for i := n; i < len(dst); i++ {
+			dst[i].Minus = true
+		}
+	}
+	return dst
+}
+
+// ReverseComplementText adapts a matcher so that it searches the reverse
+// complement of the text, for patterns such as regular expressions that can't
+// themselves be reverse complemented. Texts containing U but no T are
+// complemented as RNA. Match coordinates are mapped back to the plus strand.
+type ReverseComplementText struct {
+	Matcher
+}
+
+func (r ReverseComplementText) Match(text []byte) bool {
+	return r.Matcher.Match(seqmath.ReverseComplement(text, seqmath.IsRNA(text)))
+}
+
+func (r ReverseComplementText) FindAll(dst []Match, text []byte) []Match {
+	n := len(dst)
+	dst = r.Matcher.FindAll(dst, seqmath.ReverseComplement(text, seqmath.IsRNA(text)))
+	for i := n; i < len(dst); i++ {
+		m := &dst[i]
+		m.Start, m.End = len(text)-m.End, len(text)-m.Start
+	}
+	return dst
+}
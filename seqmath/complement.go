@@ -0,0 +1,78 @@
+package seqmath
+
+// Complement tables covering the IUPAC nucleotide ambiguity codes. Case is
+// preserved so soft-masked (lower case) bases stay masked. Characters without
+// a complement, such as gaps, are left unchanged.
+var (
+	dnaComplement [256]byte
+	rnaComplement [256]byte
+)
+
+func init() {
+	for i := range dnaComplement {
+		dnaComplement[i] = byte(i)
+	}
+	pairs := []string{"AT", "CG", "RY", "KM", "BV", "DH", "SS", "WW", "NN"}
+	for _, p := range pairs {
+		a, b := p[0], p[1]
+		dnaComplement[a], dnaComplement[b] = b, a
+		dnaComplement[a+32], dnaComplement[b+32] = b+32, a+32
+	}
+	dnaComplement['U'], dnaComplement['u'] = 'A', 'a'
+
+	rnaComplement = dnaComplement
+	rnaComplement['A'], rnaComplement['a'] = 'U', 'u'
+}
+
+// ComplementBase returns the DNA complement of an IUPAC nucleotide code.
+func ComplementBase(b byte) byte {
+	return dnaComplement[b]
+}
+
+// Complement writes the complement of s into dst, which must be at least as
+// long as s, and returns dst[:len(s)]. If rna is set, A is complemented to U.
+func Complement(dst, s []byte, rna bool) []byte {
+	table := &dnaComplement
+	if rna {
+		table = &rnaComplement
+	}
+	dst = dst[:len(s)]
+	for i, c := range s {
+		dst[i] = table[c]
+	}
+	return dst
+}
+
+// ReverseComplement returns a newly allocated reverse complement of s.
+func ReverseComplement(s []byte, rna bool) []byte {
+	rc := make([]byte, len(s))
+	table := &dnaComplement
+	if rna {
+		table = &rnaComplement
+	}
+	for i, c := range s {
+		rc[len(s)-1-i] = table[c]
+	}
+	return rc
+}
+
+// Reverse reverses b in place.
+func Reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+// IsRNA reports whether s looks like RNA, i.e. contains U but no T.
+func IsRNA(s []byte) bool {
+	hasU := false
+	for _, c := range s {
+		switch c {
+		case 'T', 't':
+			return false
+		case 'U', 'u':
+			hasU = true
+		}
+	}
+	return hasU
+}
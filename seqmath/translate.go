@@ -0,0 +1,230 @@
+package seqmath
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shenwei356/bio/seq"
+)
+
+// Genetic codes added by NCBI after those in seq.CodonTables, in the layout of
+// https://www.ncbi.nlm.nih.gov/Taxonomy/Utils/wprintgc.cgi
+func init() {
+	seq.CodonTables[32] = codonTableFromNCBI(32,
+		"Balanophoraceae Plastid Code",
+		"FFLLSSSSYY*WCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"---M------*---*----M------------MMMM---------------M------------")
+	seq.CodonTables[33] = codonTableFromNCBI(33,
+		"Cephalodiscidae Mitochondrial UAA-Tyr Code",
+		"FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG",
+		"---M-------*-------M---------------M---------------M------------")
+}
+
+// iupacBases lists the bases each IUPAC nucleotide code stands for.
+var iupacBases = map[byte]string{
+	'A': "A", 'C': "C", 'G': "G", 'T': "T",
+	'M': "AC", 'R': "AG", 'W': "AT", 'S': "CG", 'Y': "CT", 'K': "GT",
+	'V': "ACG", 'H': "ACT", 'D': "AGT", 'B': "CGT", 'N': "ACGT",
+}
+
+// codonTableFromNCBI builds a codon table from NCBI's amino acid and start
+// lines, whose codons are ordered TTT, TTC, TTA, TTG, TCT, ... GGG. Codons
+// with ambiguity codes are translated where all the codons they stand for
+// give the same amino acid.
+func codonTableFromNCBI(id int, name, aas, starts string) *seq.CodonTable {
+	const order = "TCAG"
+	t := seq.NewCodonTable(id, name)
+	aa := make(map[string]byte, 64)
+	for i := 0; i < 64; i++ {
+		codon := string([]byte{order[i/16], order[i/4%4], order[i%4]})
+		aa[codon] = aas[i]
+		switch starts[i] {
+		case 'M':
+			t.InitCodons[codon] = struct{}{}
+		case '*':
+			t.StopCodons[codon] = struct{}{}
+		}
+	}
+	for c1, b1 := range iupacBases {
+		for c2, b2 := range iupacBases {
+			for c3, b3 := range iupacBases {
+				var acid byte
+				for i := 0; i < len(b1) && acid != 'X'; i++ {
+					for j := 0; j < len(b2) && acid != 'X'; j++ {
+						for k := 0; k < len(b3); k++ {
+							a := aa[string([]byte{b1[i], b2[j], b3[k]})]
+							if acid == 0 {
+								acid = a
+							} else if a != acid {
+								acid = 'X'
+								break
+							}
+						}
+					}
+				}
+				if acid != 'X' {
+					t.Set([]byte{c1, c2, c3}, acid)
+				}
+			}
+		}
+	}
+	return t
+}
+
+// GeneticCode returns the NCBI genetic code (translation table) with the
+// given ID.
+func GeneticCode(id int) (*seq.CodonTable, error) {
+	t, ok := seq.CodonTables[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown genetic code %d", id)
+	}
+	return t, nil
+}
+
+// GeneticCodes returns all available genetic codes, ordered by ID.
+func GeneticCodes() []*seq.CodonTable {
+	tables := make([]*seq.CodonTable, 0, len(seq.CodonTables))
+	for _, t := range seq.CodonTables {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].ID < tables[j].ID })
+	return tables
+}
+
+// Frames lists the six reading frames, positive on the plus strand.
+var Frames = []int{1, 2, 3, -1, -2, -3}
+
+// codonKey returns a codon as a key of CodonTable.InitCodons or StopCodons.
+func codonKey(codon []byte) string {
+	key := []byte(strings.ToUpper(string(codon)))
+	for i, c := range key {
+		if c == 'U' {
+			key[i] = 'T'
+		}
+	}
+	return string(key)
+}
+
+// framed holds the strand of a sequence read by a frame, with the offset of
+// its first codon.
+type framed struct {
+	s      []byte
+	offset int
+	minus  bool
+	length int // of the plus strand
+}
+
+func readFrame(s []byte, frame int) framed {
+	if frame < 0 {
+		return framed{s: ReverseComplement(s, false), offset: -frame - 1, minus: true, length: len(s)}
+	}
+	return framed{s: s, offset: frame - 1, length: len(s)}
+}
+
+// coords converts codons [from, to) of the framed strand to 0-based,
+// half-open coordinates on the plus strand.
+func (f framed) coords(from, to int) (start, end int) {
+	start, end = f.offset+3*from, f.offset+3*to
+	if f.minus {
+		start, end = f.length-end, f.length-start
+	}
+	return start, end
+}
+
+func (f framed) codons() int {
+	if len(f.s) < f.offset {
+		return 0
+	}
+	return (len(f.s) - f.offset) / 3
+}
+
+func (f framed) codon(i int) []byte {
+	p := f.offset + 3*i
+	return f.s[p : p+3]
+}
+
+// TranslateFrame translates a nucleotide sequence in one of the frames 1, 2,
+// 3, -1, -2 or -3, returning the protein and the 0-based, half-open plus
+// strand coordinates of the codons translated. Stop codons are translated as
+// '*' and codons with unknown bases as 'X'.
+func TranslateFrame(t *seq.CodonTable, s []byte, frame int) (protein []byte, start, end int, err error) {
+	f := readFrame(s, frame)
+	n := f.codons()
+	protein = make([]byte, n)
+	for i := 0; i < n; i++ {
+		if protein[i], err = t.Get(f.codon(i), true); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	start, end = f.coords(0, n)
+	return protein, start, end, nil
+}
+
+// ORF is an open reading frame. Start and End are 0-based, half-open plus
+// strand coordinates that include the stop codon, if any.
+type ORF struct {
+	Frame    int
+	Start    int
+	End      int
+	Protein  []byte // without the stop, starting with M
+	Complete bool   // ends with a stop codon
+}
+
+// ORFOptions control which ORFs FindORFs reports.
+type ORFOptions struct {
+	// MinLength is the minimum number of amino acids, excluding the stop.
+	MinLength int
+	// AltStarts accepts all start codons of the genetic code, not only ATG.
+	AltStarts bool
+	// Partial also reports ORFs running off the end of the sequence without a
+	// stop codon.
+	Partial bool
+}
+
+// FindORFs finds the longest ORF starting at each start codon not already
+// inside an ORF in the given frame, i.e. from the first start codon after a
+// stop to the next stop.
+func FindORFs(t *seq.CodonTable, s []byte, frame int, opts ORFOptions) ([]ORF, error) {
+	f := readFrame(s, frame)
+	n := f.codons()
+	var orfs []ORF
+	var protein []byte
+	inORF, from := false, 0
+	emit := func(to int, complete bool) {
+		if len(protein) >= opts.MinLength && len(protein) > 0 {
+			stop := to
+			if complete {
+				stop++
+			}
+			start, end := f.coords(from, stop)
+			orfs = append(orfs, ORF{Frame: frame, Start: start, End: end, Protein: protein, Complete: complete})
+		}
+		inORF, protein = false, nil
+	}
+	for i := 0; i < n; i++ {
+		codon := f.codon(i)
+		aa, err := t.Get(codon, true)
+		if err != nil {
+			return nil, err
+		}
+		if !inORF {
+			key := codonKey(codon)
+			if key != "ATG" {
+				if _, ok := t.InitCodons[key]; !ok || !opts.AltStarts {
+					continue
+				}
+			}
+			inORF, from = true, i
+			aa = 'M'
+		} else if aa == '*' {
+			emit(i, true)
+			continue
+		}
+		protein = append(protein, aa)
+	}
+	if inORF && opts.Partial {
+		emit(n, false)
+	}
+	return orfs, nil
+}
@@ -0,0 +1,250 @@
+// Package twobit reads and writes the UCSC .2bit format, which packs
+// sequences at four bases per byte, keeps runs of N and of soft-masked (lower
+// case) bases as blocks on the side, and starts with an index of sequence
+// names for random access.
+package twobit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"sort"
+	"sync"
+)
+
+// signature starts 2bit files, in the byte order of the rest of the file.
+const signature = 0x1A412743
+
+// packedBases are the bases of each 2-bit code.
+const packedBases = "TCAG"
+
+var ErrNotTwoBit = errors.New("twobit: not in 2bit format")
+
+// IsTwoBit reports whether header, the first bytes of a file, starts a 2bit
+// file.
+func IsTwoBit(header []byte) bool {
+	_, err := byteOrder(header)
+	return err == nil
+}
+
+func byteOrder(header []byte) (binary.ByteOrder, error) {
+	if len(header) < 4 {
+		return nil, ErrNotTwoBit
+	}
+	switch {
+	case binary.LittleEndian.Uint32(header) == signature:
+		return binary.LittleEndian, nil
+	case binary.BigEndian.Uint32(header) == signature:
+		return binary.BigEndian, nil
+	}
+	return nil, ErrNotTwoBit
+}
+
+// Seq is a sequence of the index.
+type Seq struct {
+	Name   string
+	Length int64
+	offset int64 // of its record
+}
+
+// block is a run of N or of masked bases, with 0-based, half-open
+// coordinates.
+type block struct {
+	start, end int64
+}
+
+// record is the part of a sequence record before its bases.
+type record struct {
+	nBlocks    []block
+	maskBlocks []block
+	dnaOffset  int64
+}
+
+// File provides random access to the sequences of a 2bit file. It caches the
+// blocks of the last sequence read, and is safe for concurrent use.
+type File struct {
+	Seqs   []Seq // in index order
+	r      io.ReaderAt
+	size   int64 // of the file, or -1 if unknown
+	order  binary.ByteOrder
+	byName map[string]int
+
+	mu     sync.Mutex
+	cached int // index in Seqs of the cached record, or -1
+	record record
+}
+
+// NewFile reads the header and index of the 2bit file read by r. Readers
+// with a Size or Stat method, such as *bytes.Reader and *os.File, let
+// corrupt block counts be told from the file size.
+func NewFile(r io.ReaderAt) (*File, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, 0, math.MaxInt64))
+	var header [16]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, ErrNotTwoBit
+	}
+	order, err := byteOrder(header[:])
+	if err != nil {
+		return nil, err
+	}
+	version := order.Uint32(header[4:])
+	if version > 1 {
+		return nil, fmt.Errorf("twobit: unsupported version %d", version)
+	}
+	n := order.Uint32(header[8:])
+
+	f := &File{r: r, size: -1, order: order, byName: make(map[string]int), cached: -1}
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		f.size = r.Size()
+	case interface{ Stat() (fs.FileInfo, error) }:
+		if info, err := r.Stat(); err == nil {
+			f.size = info.Size()
+		}
+	}
+	for i := uint32(0); i < n; i++ {
+		nameLen, err := br.ReadByte()
+		if err != nil {
+			return nil, errTruncated(err)
+		}
+		entry := make([]byte, int(nameLen)+4+4*int(version))
+		if _, err := io.ReadFull(br, entry); err != nil {
+			return nil, errTruncated(err)
+		}
+		s := Seq{Name: string(entry[:nameLen])}
+		if version == 1 {
+			s.offset = int64(order.Uint64(entry[nameLen:]))
+		} else {
+			s.offset = int64(order.Uint32(entry[nameLen:]))
+		}
+		if _, dup := f.byName[s.Name]; dup {
+			return nil, fmt.Errorf("twobit: duplicate sequence name %q", s.Name)
+		}
+		f.byName[s.Name] = len(f.Seqs)
+		f.Seqs = append(f.Seqs, s)
+	}
+	var size [4]byte
+	for i := range f.Seqs {
+		if _, err := r.ReadAt(size[:], f.Seqs[i].offset); err != nil {
+			return nil, errTruncated(err)
+		}
+		f.Seqs[i].Length = int64(order.Uint32(size[:]))
+	}
+	return f, nil
+}
+
+func errTruncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("twobit: truncated file")
+	}
+	return err
+}
+
+// Lookup returns the named sequence.
+func (f *File) Lookup(name string) (Seq, bool) {
+	i, ok := f.byName[name]
+	if !ok {
+		return Seq{}, false
+	}
+	return f.Seqs[i], true
+}
+
+// readRecord returns the blocks of sequence i, reading them unless cached.
+func (f *File) readRecord(i int) (record, error) {
+	if i == f.cached {
+		return f.record, nil
+	}
+	s := f.Seqs[i]
+	br := bufio.NewReader(io.NewSectionReader(f.r, s.offset+4, math.MaxInt64))
+	var rec record
+	var err error
+	if rec.nBlocks, err = f.readBlocks(br, s, s.offset+4); err != nil {
+		return rec, err
+	}
+	maskOffset := s.offset + 4 + 4 + 8*int64(len(rec.nBlocks))
+	if rec.maskBlocks, err = f.readBlocks(br, s, maskOffset); err != nil {
+		return rec, err
+	}
+	// The blocks are followed by a reserved word, then the bases.
+	rec.dnaOffset = maskOffset + 4 + 8*int64(len(rec.maskBlocks)) + 4
+	f.cached, f.record = i, rec
+	return rec, nil
+}
+
+// readBlocks reads a count of blocks of sequence s, their starts and their
+// sizes, from offset in the file. Counts that can't be right, with more
+// blocks than bases or than fit in the rest of the file, are errors rather
+// than allocated.
+func (f *File) readBlocks(r io.Reader, s Seq, offset int64) ([]block, error) {
+	var count uint32
+	if err := binary.Read(r, f.order, &count); err != nil {
+		return nil, errTruncated(err)
+	}
+	if int64(count) > s.Length {
+		return nil, fmt.Errorf("twobit: sequence %q has %d blocks but only %d bases", s.Name, count, s.Length)
+	}
+	if f.size >= 0 && offset+4+8*int64(count) > f.size {
+		return nil, errTruncated(io.ErrUnexpectedEOF)
+	}
+	values := make([]uint32, 2*int64(count))
+	if err := binary.Read(r, f.order, values); err != nil {
+		return nil, errTruncated(err)
+	}
+	blocks := make([]block, count)
+	for i := range blocks {
+		start := int64(values[i])
+		blocks[i] = block{start, start + int64(values[int(count)+i])}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].start < blocks[j].start })
+	return blocks, nil
+}
+
+// Fetch returns bases start to end (0-based, half-open) of the named
+// sequence, clipped to its length, with N blocks as N and masked blocks in
+// lower case.
+func (f *File) Fetch(name string, start, end int64) ([]byte, error) {
+	i, ok := f.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("sequence %q not found in index", name)
+	}
+	start, end = max(start, 0), min(end, f.Seqs[i].Length)
+	if start >= end {
+		return []byte{}, nil
+	}
+
+	f.mu.Lock()
+	rec, err := f.readRecord(i)
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	packed := make([]byte, (end-1)/4-start/4+1)
+	if _, err := f.r.ReadAt(packed, rec.dnaOffset+start/4); err != nil {
+		return nil, errTruncated(err)
+	}
+	s := make([]byte, end-start)
+	for j := range s {
+		pos := start + int64(j)
+		code := packed[pos/4-start/4] >> (6 - 2*(pos%4)) & 3
+		s[j] = packedBases[code]
+	}
+	applyBlocks(s, start, rec.nBlocks, func(c byte) byte { return 'N' })
+	applyBlocks(s, start, rec.maskBlocks, func(c byte) byte { return c | 0x20 })
+	return s, nil
+}
+
+// applyBlocks changes the bases of s, which start at start, that fall in the
+// blocks, which are sorted and don't overlap.
+func applyBlocks(s []byte, start int64, blocks []block, change func(byte) byte) {
+	end := start + int64(len(s))
+	i := sort.Search(len(blocks), func(i int) bool { return blocks[i].end > start })
+	for ; i < len(blocks) && blocks[i].start < end; i++ {
+		for pos := max(blocks[i].start, start); pos < min(blocks[i].end, end); pos++ {
+			s[pos-start] = change(s[pos-start])
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package twobit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func writeTwoBit(t *testing.T, names []string, seqs []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i, name := range names {
+		if err := w.Add(name, []byte(seqs[i])); err != nil {
+			t.Fatalf("Add(%s): %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		seq  string
+		want string
+	}{
+		{"empty", "", ""},
+		{"one base", "G", "G"},
+		{"one packed byte", "ACGT", "ACGT"},
+		{"partial last byte", "ACGTA", "ACGTA"},
+		{"partial last byte 2", "ACGTAC", "ACGTAC"},
+		{"partial last byte 3", "ACGTACG", "ACGTACG"},
+		{"masked", "acgt", "acgt"},
+		{"masked inside", "ACgtAC", "ACgtAC"},
+		{"all N", "NNNNN", "NNNNN"},
+		{"leading N", "NNACGT", "NNACGT"},
+		{"trailing N", "ACGTNN", "ACGTNN"},
+		{"masked N", "AnnA", "AnnA"},
+		{"N run crossing mask", "ACNNnnacNA", "ACNNnnacNA"},
+		{"ambiguity codes", "ACRYKMgtrykm", "ACNNNNgtnnnn"},
+		{"other characters", "A-C*G.T", "ANCNGNT"},
+		{"long runs", strings.Repeat("a", 1000) + strings.Repeat("N", 1001) + strings.Repeat("C", 999),
+			strings.Repeat("a", 1000) + strings.Repeat("N", 1001) + strings.Repeat("C", 999)},
+	}
+	names := make([]string, len(tests))
+	seqs := make([]string, len(tests))
+	for i, tt := range tests {
+		names[i], seqs[i] = tt.name, tt.seq
+	}
+	data := writeTwoBit(t, names, seqs)
+	if !IsTwoBit(data) {
+		t.Fatal("IsTwoBit = false")
+	}
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Seqs) != len(tests) {
+		t.Fatalf("%d sequences, want %d", len(f.Seqs), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok := f.Lookup(tt.name)
+			if !ok || s != f.Seqs[i] || s.Length != int64(len(tt.want)) {
+				t.Fatalf("Lookup = %+v, %v, want sequence %d of length %d", s, ok, i, len(tt.want))
+			}
+			got, err := f.Fetch(tt.name, 0, s.Length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Fetch = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchRanges(t *testing.T) {
+	// Masked and N runs start and end at every position within a packed byte.
+	const seq = "nnACGTNNNacgtNaCGTnNnAcgTTNNNNa"
+	f, err := NewFile(bytes.NewReader(writeTwoBit(t, []string{"a", "b"}, []string{"ACGT", seq})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for start := 0; start <= len(seq); start++ {
+		for end := start; end <= len(seq); end++ {
+			got, err := f.Fetch("b", int64(start), int64(end))
+			if err != nil {
+				t.Fatalf("Fetch(%d, %d): %v", start, end, err)
+			}
+			if string(got) != seq[start:end] {
+				t.Errorf("Fetch(%d, %d) = %q, want %q", start, end, got, seq[start:end])
+			}
+		}
+	}
+
+	tests := []struct {
+		name       string
+		seq        string
+		start, end int64
+		want       string
+	}{
+		{"clipped start", "b", -5, 3, "nnA"},
+		{"clipped end", "b", 28, 100, "NNa"},
+		{"empty", "b", 5, 5, ""},
+		{"reversed", "b", 6, 2, ""},
+		{"past the end", "b", 40, 50, ""},
+		{"other sequence", "a", 1, 3, "CG"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.Fetch(tt.seq, tt.start, tt.end)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("Fetch = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+	if _, err := f.Fetch("c", 0, 1); err == nil {
+		t.Errorf("Fetch of a missing sequence succeeded")
+	}
+}
+
+// bigEndianTwoBit is a hand-made big-endian 2bit file holding "chr" =
+// "ACGTNNac".
+var bigEndianTwoBit = []byte{
+	0x1A, 0x41, 0x27, 0x43, // signature
+	0, 0, 0, 0, // version
+	0, 0, 0, 1, // sequence count
+	0, 0, 0, 0, // reserved
+	3, 'c', 'h', 'r', 0, 0, 0, 24, // index
+	0, 0, 0, 8, // length
+	0, 0, 0, 1, 0, 0, 0, 4, 0, 0, 0, 2, // N blocks
+	0, 0, 0, 1, 0, 0, 0, 6, 0, 0, 0, 2, // masked blocks
+	0, 0, 0, 0, // reserved
+	0x9c, 0x09, // ACGT, TTAC
+}
+
+func TestBigEndian(t *testing.T) {
+	if !IsTwoBit(bigEndianTwoBit) {
+		t.Fatal("IsTwoBit = false")
+	}
+	f, err := NewFile(bytes.NewReader(bigEndianTwoBit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Fetch("chr", 0, 8)
+	if err != nil || string(got) != "ACGTNNac" {
+		t.Errorf("Fetch = %q, %v, want %q", got, err, "ACGTNNac")
+	}
+}
+
+// toVersion1 rewrites a version 0 file written by Writer with the 64-bit
+// offsets of version 1.
+func toVersion1(t *testing.T, data []byte) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+	n := int(le.Uint32(data[8:]))
+	out := append([]byte(nil), data[:16]...)
+	le.PutUint32(out[4:], 1)
+	i := 16
+	for j := 0; j < n; j++ {
+		nameLen := int(data[i])
+		out = append(out, data[i:i+1+nameLen]...)
+		offset := uint64(le.Uint32(data[i+1+nameLen:])) + 4*uint64(n)
+		out = le.AppendUint64(out, offset)
+		i += 1 + nameLen + 4
+	}
+	return append(out, data[i:]...)
+}
+
+func TestVersion1(t *testing.T) {
+	data := toVersion1(t, writeTwoBit(t, []string{"a", "bb"}, []string{"ACGTn", "NNccGG"}))
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"a": "ACGTn", "bb": "NNccGG"} {
+		got, err := f.Fetch(name, 0, 100)
+		if err != nil || string(got) != want {
+			t.Errorf("Fetch(%s) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestNewFileErrors(t *testing.T) {
+	valid := writeTwoBit(t, []string{"a"}, []string{"ACGT"})
+	version2 := bytes.Clone(valid)
+	version2[4] = 2
+	duplicate := toVersion1(t, writeTwoBit(t, []string{"a", "b"}, []string{"A", "C"}))
+	duplicate[16+1] = 'b'
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not 2bit", []byte(">a\nACGT\nACGTACGTACGT\n"), ErrNotTwoBit.Error()},
+		{"short", valid[:10], ErrNotTwoBit.Error()},
+		{"truncated index", valid[:18], "truncated"},
+		{"truncated record", valid[:len(valid)-16], "truncated"},
+		{"version 2", version2, "unsupported version 2"},
+		{"duplicate name", duplicate, "duplicate sequence name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFile(bytes.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := NewFile(bytes.NewReader([]byte("xx"))); !errors.Is(err, ErrNotTwoBit) {
+		t.Errorf("error = %v, want ErrNotTwoBit", err)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		seqName string
+		want    string
+	}{
+		{"empty name", "", "1 to 255 bytes"},
+		{"long name", strings.Repeat("x", 256), "1 to 255 bytes"},
+		{"duplicate name", "a", "duplicate sequence name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWriter(&bytes.Buffer{})
+			if err := w.Add("a", []byte("ACGT")); err != nil {
+				t.Fatal(err)
+			}
+			err := w.Add(tt.seqName, []byte("ACGT"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchCorruptBlocks(t *testing.T) {
+	valid := writeTwoBit(t, []string{"a"}, []string{"ACGTNNacgt"})
+	// The record of "a" follows the 16 byte header and its 6 byte index
+	// entry, starting with its length and then its count of N blocks.
+	const record = 16 + 6
+	le := binary.LittleEndian
+	tooManyN := bytes.Clone(valid)
+	le.PutUint32(tooManyN[record+4:], 0x7ffffff0)
+	tooManyMasked := bytes.Clone(valid)
+	le.PutUint32(tooManyMasked[record+4+4+8:], 11)
+	pastEnd := bytes.Clone(valid)
+	le.PutUint32(pastEnd[record:], 0xffffffff)
+	le.PutUint32(pastEnd[record+4:], 0x7ffffff0)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"N blocks", tooManyN, "blocks but only 10 bases"},
+		{"masked blocks", tooManyMasked, "blocks but only 10 bases"},
+		{"past the end of the file", pastEnd, "truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFile(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.Fetch("a", 0, 4)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package twobit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Writer writes sequences to a 2bit file. The index at the start of the file
+// gives the offset of every sequence, so sequences are held in memory, packed,
+// until Close writes the file.
+type Writer struct {
+	w     io.Writer
+	seqs  []*packedSeq
+	names map[string]bool
+}
+
+// packedSeq is a sequence as stored in a 2bit file.
+type packedSeq struct {
+	name       string
+	length     int64
+	nBlocks    []block
+	maskBlocks []block
+	packed     []byte
+}
+
+// NewWriter returns a Writer writing a 2bit file to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, names: make(map[string]bool)}
+}
+
+// isBase marks the bases that 2bit stores; anything else is stored as N.
+var isBase = [256]bool{'A': true, 'C': true, 'G': true, 'T': true, 'a': true, 'c': true, 'g': true, 't': true}
+
+// baseCodes are the 2-bit codes of bases, 0 (T) for N.
+var baseCodes = [256]byte{'C': 1, 'A': 2, 'G': 3, 'c': 1, 'a': 2, 'g': 3}
+
+// Add adds a sequence. Bases other than A, C, G and T become N, and lower case
+// bases are masked.
+func (w *Writer) Add(name string, s []byte) error {
+	if name == "" || len(name) > math.MaxUint8 {
+		return fmt.Errorf("twobit: sequence names must be 1 to 255 bytes long: %q", name)
+	}
+	if w.names[name] {
+		return fmt.Errorf("twobit: duplicate sequence name %q", name)
+	}
+	if int64(len(s)) > math.MaxUint32 {
+		return fmt.Errorf("twobit: sequence %s is too long", name)
+	}
+	w.names[name] = true
+
+	p := &packedSeq{name: name, length: int64(len(s)), packed: make([]byte, (len(s)+3)/4)}
+	for i, c := range s {
+		p.packed[i/4] |= baseCodes[c] << (6 - 2*(i%4))
+		p.nBlocks = extendBlocks(p.nBlocks, int64(i), !isBase[c])
+		p.maskBlocks = extendBlocks(p.maskBlocks, int64(i), 'a' <= c && c <= 'z')
+	}
+	w.seqs = append(w.seqs, p)
+	return nil
+}
+
+// extendBlocks adds position i to the last block, or a new one, if in is set.
+func extendBlocks(blocks []block, i int64, in bool) []block {
+	if !in {
+		return blocks
+	}
+	if n := len(blocks); n > 0 && blocks[n-1].end == i {
+		blocks[n-1].end++
+		return blocks
+	}
+	return append(blocks, block{i, i + 1})
+}
+
+// size returns the size of the record of the sequence.
+func (p *packedSeq) size() int64 {
+	return 4 + 4 + 8*int64(len(p.nBlocks)) + 4 + 8*int64(len(p.maskBlocks)) + 4 + int64(len(p.packed))
+}
+
+// Close writes the file, in version 1 of the format, with 64-bit offsets,
+// only if it is larger than 4 GiB. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	var version uint32
+	indexSize := int64(16)
+	for _, p := range w.seqs {
+		indexSize += 1 + int64(len(p.name)) + 4
+	}
+	size := indexSize
+	for _, p := range w.seqs {
+		size += p.size()
+	}
+	if size > math.MaxUint32 {
+		version = 1
+		indexSize += 4 * int64(len(w.seqs))
+	}
+
+	le := binary.LittleEndian
+	b := le.AppendUint32(nil, signature)
+	b = le.AppendUint32(b, version)
+	b = le.AppendUint32(b, uint32(len(w.seqs)))
+	b = le.AppendUint32(b, 0) // reserved
+	offset := indexSize
+	for _, p := range w.seqs {
+		b = append(append(b, byte(len(p.name))), p.name...)
+		if version == 1 {
+			b = le.AppendUint64(b, uint64(offset))
+		} else {
+			b = le.AppendUint32(b, uint32(offset))
+		}
+		offset += p.size()
+	}
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+
+	for _, p := range w.seqs {
+		b = le.AppendUint32(b[:0], uint32(p.length))
+		for _, blocks := range [][]block{p.nBlocks, p.maskBlocks} {
+			b = le.AppendUint32(b, uint32(len(blocks)))
+			for _, bl := range blocks {
+				b = le.AppendUint32(b, uint32(bl.start))
+			}
+			for _, bl := range blocks {
+				b = le.AppendUint32(b, uint32(bl.end-bl.start))
+			}
+		}
+		b = le.AppendUint32(b, 0) // reserved
+		if _, err := w.w.Write(b); err != nil {
+			return err
+		}
+		if _, err := w.w.Write(p.packed); err != nil {
+			return err
+		}
+	}
+	w.seqs = nil
+	return nil
+}